@@ -0,0 +1,87 @@
+package lineflushwriter
+
+import "bytes"
+
+const escape = 0x1b
+
+// stripEscapes returns given data without ANSI CSI escape sequences. Data is
+// returned as is if it has no escape sequences.
+func stripEscapes(data []byte) []byte {
+	start := bytes.IndexByte(data, escape)
+	if start < 0 {
+		return data
+	}
+
+	result := append([]byte(nil), data[:start]...)
+
+	for start >= 0 {
+		data = data[start:]
+
+		size := escapeLength(data)
+		if size < 0 {
+			// Unfinished sequence at the end of line, which is written
+			// anyway, e.g. on close, is kept as is.
+			return append(result, data...)
+		}
+
+		if size == 0 {
+			// Not a CSI sequence, escape byte itself is kept.
+			size = 1
+			result = append(result, escape)
+		}
+
+		data = data[size:]
+
+		start = bytes.IndexByte(data, escape)
+		if start < 0 {
+			result = append(result, data...)
+		} else {
+			result = append(result, data[:start]...)
+		}
+	}
+
+	return result
+}
+
+// incompleteEscape returns length of escape sequence at the end of given data,
+// that is not complete yet, or zero if there is no such sequence.
+func incompleteEscape(data []byte) int {
+	start := bytes.LastIndexByte(data, escape)
+	if start < 0 {
+		return 0
+	}
+
+	if escapeLength(data[start:]) < 0 {
+		return len(data) - start
+	}
+
+	return 0
+}
+
+// escapeLength returns length of CSI escape sequence, that given data begins
+// with, zero if data does not begin with CSI sequence or -1 if sequence is not
+// complete.
+func escapeLength(data []byte) int {
+	if len(data) < 2 {
+		return -1
+	}
+
+	if data[0] != escape || data[1] != '[' {
+		return 0
+	}
+
+	for i := 2; i < len(data); i++ {
+		switch {
+		case data[i] >= 0x20 && data[i] <= 0x3f:
+			// Parameter and intermediate bytes.
+
+		case data[i] >= 0x40 && data[i] <= 0x7e:
+			return i + 1
+
+		default:
+			return 0
+		}
+	}
+
+	return -1
+}
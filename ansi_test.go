@@ -0,0 +1,77 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_StripsEscapeSequencesFromLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithStripANSI(true),
+	)
+
+	writer.Write([]byte("\x1b[31merror\x1b[0m\n\x1b[1;32"))
+	test.Equal("error\n", buffer.String())
+
+	writer.Write([]byte("mok\x1b[0m \x1bx\n\x1b[1"))
+	test.Equal("error\nok \x1bx\n", buffer.String())
+
+	writer.Close()
+	test.Equal("error\nok \x1bx\n\x1b[1\n", buffer.String())
+}
+
+func TestWriter_KeepsIncompleteEscapeSequenceOnFlush(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithStripANSI(true),
+	)
+
+	writer.Write([]byte("1\x1b[3"))
+	writer.Flush()
+	test.Equal("1", buffer.String())
+
+	writer.Write([]byte("1m2\n"))
+	test.Equal("12\n", buffer.String())
+}
+
+func TestWriter_KeepsUnfinishedEscapeSequenceOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	for _, data := range []string{"abc\x1b[31", "abc\x1b"} {
+		buffer := &bytes.Buffer{}
+		writer := New(
+			nopCloser{buffer}, &sync.Mutex{}, false,
+			WithStripANSI(true),
+		)
+
+		writer.Write([]byte(data))
+
+		test.NoError(writer.Close())
+		test.Equal(data, buffer.String())
+	}
+}
+
+func TestWriter_KeepsTrailingEscapeOnStripDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithStripANSI(true), WithStripDelimiter(),
+	)
+
+	writer.Write([]byte("abc\x1b\n\x1b[1mdef\x1b[\n"))
+	test.Equal("abc\x1bdef\x1b[", buffer.String())
+
+	test.NoError(writer.Close())
+}
@@ -0,0 +1,173 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrInvalidQueueSize is returned by NewAsync if queue size is not positive.
+var ErrInvalidQueueSize = errors.New("lineflushwriter: invalid queue size")
+
+// ErrQueueFull is returned by writer returned by NewAsync if queue is full and
+// ErrorPolicy is specified by WithQueueFullPolicy.
+var ErrQueueFull = errors.New("lineflushwriter: queue is full")
+
+// QueueFullPolicy specifies, what writer returned by NewAsync does with data,
+// that does not fit into full queue.
+type QueueFullPolicy int
+
+const (
+	// BlockPolicy makes Writer to wait until queue has free space.
+	BlockPolicy QueueFullPolicy = iota
+
+	// ErrorPolicy makes Writer to return ErrQueueFull without writing data.
+	ErrorPolicy
+
+	// DropPolicy makes Writer to drop data and count its lines, as if data
+	// was written.
+	DropPolicy
+)
+
+// WithQueueFullPolicy makes writer returned by NewAsync to handle data, that
+// does not fit into full queue, according to given policy. Lines, that are
+// dropped due to DropPolicy, are reported by Dropped. Option has no effect on
+// other writers.
+func WithQueueFullPolicy(policy QueueFullPolicy) Option {
+	return func(writer *Writer) {
+		writer.queuePolicy = policy
+	}
+}
+
+// NewAsync returns new Writer, that works exactly like one returned by New,
+// but writes into backend from dedicated goroutine, so writing methods do not
+// wait for slow backend. Data, that is written into backend by single write
+// call, is passed to goroutine via queue of `queueSize` entries and is
+// written into backend in the same order. Writing methods block only while
+// queue is full, unless other policy is specified by WithQueueFullPolicy, so
+// memory is bounded.
+//
+// Error of writing into backend is returned by the next write call and by
+// Close, data queued after error is discarded. Close waits until all queued
+// data is written and goroutine exits, then closes backend.
+func NewAsync(
+	backend io.WriteCloser,
+	queueSize int,
+	ensureNewline bool,
+	options ...Option,
+) (*Writer, error) {
+	if backend == nil {
+		return nil, ErrNilBackend
+	}
+
+	if queueSize <= 0 {
+		return nil, ErrInvalidQueueSize
+	}
+
+	async := &asyncBackend{
+		backend: backend,
+		queue:   make(chan []byte, queueSize),
+		done:    make(chan struct{}),
+	}
+
+	writer, err := NewChecked(async, nil, ensureNewline, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	async.writer = writer
+
+	go async.run()
+
+	return writer, nil
+}
+
+// asyncBackend implements io.WriteCloser, that writes data into backend from
+// own goroutine.
+type asyncBackend struct {
+	backend io.WriteCloser
+	queue   chan []byte
+	done    chan struct{}
+
+	// writer is used to count dropped lines, it's safe because backend is
+	// written only while writer mutex is held.
+	writer *Writer
+
+	mutex   sync.Mutex
+	failure error
+}
+
+// run writes queued data into backend until queue is closed.
+func (async *asyncBackend) run() {
+	defer close(async.done)
+
+	for data := range async.queue {
+		if async.err() != nil {
+			continue
+		}
+
+		_, err := async.backend.Write(data)
+		if err != nil {
+			async.mutex.Lock()
+			async.failure = err
+			async.mutex.Unlock()
+		}
+	}
+}
+
+func (async *asyncBackend) err() error {
+	async.mutex.Lock()
+	defer async.mutex.Unlock()
+
+	return async.failure
+}
+
+func (async *asyncBackend) Write(data []byte) (int, error) {
+	if err := async.err(); err != nil {
+		return 0, err
+	}
+
+	if async.writer.queuePolicy == BlockPolicy {
+		async.queue <- append([]byte(nil), data...)
+
+		return len(data), nil
+	}
+
+	select {
+	case async.queue <- append([]byte(nil), data...):
+	default:
+		if async.writer.queuePolicy == ErrorPolicy {
+			return 0, ErrQueueFull
+		}
+
+		lines := countLines(data, async.writer.terminator)
+
+		async.writer.dropped += uint64(lines)
+	}
+
+	return len(data), nil
+}
+
+// countLines returns amount of lines in given data, including incomplete line
+// at the end of data.
+func countLines(data []byte, delimiter []byte) int {
+	count := bytes.Count(data, delimiter)
+	if !bytes.HasSuffix(data, delimiter) {
+		count++
+	}
+
+	return count
+}
+
+func (async *asyncBackend) Close() error {
+	close(async.queue)
+
+	<-async.done
+
+	if async.writer.keepBackend {
+		return async.err()
+	}
+
+	return errors.Join(async.err(), async.backend.Close())
+}
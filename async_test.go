@@ -0,0 +1,213 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type gatedWriter struct {
+	*limitWriter
+	unblock chan struct{}
+}
+
+func (writer *gatedWriter) Write(data []byte) (int, error) {
+	<-writer.unblock
+
+	return writer.limitWriter.Write(data)
+}
+
+// stalledWriter blocks every write until unblocked, reporting that write was
+// started.
+type stalledWriter struct {
+	*bytes.Buffer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (writer *stalledWriter) Write(data []byte) (int, error) {
+	select {
+	case writer.started <- struct{}{}:
+	default:
+	}
+
+	<-writer.unblock
+
+	return writer.Buffer.Write(data)
+}
+
+func (writer *stalledWriter) Close() error {
+	return nil
+}
+
+func newStalledWriter() *stalledWriter {
+	return &stalledWriter{
+		Buffer:  &bytes.Buffer{},
+		started: make(chan struct{}, 1),
+		unblock: make(chan struct{}),
+	}
+}
+
+func TestNewAsync_BlocksIfQueueIsFullByDefault(t *testing.T) {
+	test := assert.New(t)
+
+	backend := newStalledWriter()
+
+	writer, err := NewAsync(backend, 1, false)
+	test.NoError(err)
+
+	writer.Write([]byte("1\n"))
+	<-backend.started
+	writer.Write([]byte("2\n"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		writer.Write([]byte("3\n"))
+	}()
+
+	select {
+	case <-done:
+		test.Fail("write should block while queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(backend.unblock)
+	<-done
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n3\n", backend.String())
+	test.Zero(writer.Dropped())
+}
+
+func TestNewAsync_ReturnsErrorIfQueueIsFullAndErrorPolicy(t *testing.T) {
+	test := assert.New(t)
+
+	backend := newStalledWriter()
+
+	writer, err := NewAsync(
+		backend, 1, false,
+		WithQueueFullPolicy(ErrorPolicy),
+	)
+	test.NoError(err)
+
+	writer.Write([]byte("1\n"))
+	<-backend.started
+	writer.Write([]byte("2\n"))
+
+	written, err := writer.Write([]byte("3\n4\n"))
+	test.True(errors.Is(err, ErrQueueFull))
+	test.Zero(written)
+
+	close(backend.unblock)
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n", backend.String())
+	test.Zero(writer.Dropped())
+}
+
+func TestNewAsync_DropsLinesIfQueueIsFullAndDropPolicy(t *testing.T) {
+	test := assert.New(t)
+
+	backend := newStalledWriter()
+
+	writer, err := NewAsync(
+		backend, 1, false,
+		WithQueueFullPolicy(DropPolicy),
+	)
+	test.NoError(err)
+
+	writer.Write([]byte("1\n"))
+	<-backend.started
+	writer.Write([]byte("2\n"))
+
+	written, err := writer.Write([]byte("3\n4\n"))
+	test.NoError(err)
+	test.Equal(4, written)
+	test.Equal(uint64(2), writer.Dropped())
+
+	close(backend.unblock)
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n", backend.String())
+	test.Equal(uint64(2), writer.Dropped())
+}
+
+func TestNewAsync_WritesIntoBackendFromGoroutine(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &gatedWriter{
+		limitWriter: &limitWriter{Buffer: &bytes.Buffer{}, limit: 100},
+		unblock:     make(chan struct{}),
+	}
+
+	writer, err := NewAsync(backend, 2, true)
+	test.NoError(err)
+
+	// First line is taken by goroutine, next two are queued.
+	for i := 0; i < 3; i++ {
+		_, err := writer.Write([]byte("1\n"))
+		test.NoError(err)
+	}
+
+	close(backend.unblock)
+
+	writer.Write([]byte("2\n3"))
+
+	test.NoError(writer.Close())
+	test.Equal("1\n1\n1\n2\n3\n", backend.String())
+	test.True(backend.closed)
+}
+
+func TestNewAsync_DrainsQueueOnCloseWithoutBackendClose(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &gatedWriter{
+		limitWriter: &limitWriter{Buffer: &bytes.Buffer{}, limit: 100},
+		unblock:     make(chan struct{}),
+	}
+
+	writer, err := NewAsync(backend, 3, true, WithoutBackendClose())
+	test.NoError(err)
+
+	writer.Write([]byte("1\n2\n"))
+	writer.Write([]byte("3"))
+
+	go close(backend.unblock)
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n3\n", backend.String())
+	test.False(backend.closed)
+}
+
+func TestNewAsync_ReturnsBackendError(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+
+	writer, err := NewAsync(backend, 1, false)
+	test.NoError(err)
+
+	writer.Write([]byte("12\n"))
+	writer.Write([]byte("3\n"))
+
+	err = writer.Close()
+	test.Error(err)
+	test.True(errors.Is(err, ErrCloseBackend))
+	test.Equal("12", backend.String())
+	test.True(backend.closed)
+}
+
+func TestNewAsync_ReturnsErrorOnInvalidArguments(t *testing.T) {
+	test := assert.New(t)
+
+	_, err := NewAsync(nil, 1, false)
+	test.Equal(ErrNilBackend, err)
+
+	_, err = NewAsync(&writeCounter{}, 0, false)
+	test.Equal(ErrInvalidQueueSize, err)
+}
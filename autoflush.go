@@ -0,0 +1,57 @@
+package lineflushwriter
+
+import (
+	"sync"
+	"time"
+)
+
+// StartAutoFlush starts goroutine, that will flush buffered incomplete line
+// into backend every `interval`. Returned function stops that goroutine and
+// waits until it exits, it is safe to call it several times. Close also stops
+// all started goroutines.
+func (writer *Writer) StartAutoFlush(interval time.Duration) (stop func()) {
+	var (
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+		once    = sync.Once{}
+	)
+
+	signal := func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	writer.mutex.Lock()
+	if writer.closed {
+		signal()
+	} else {
+		writer.stops = append(writer.stops, signal)
+	}
+	writer.mutex.Unlock()
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				if writer.Flush() == ErrClosed {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal()
+
+		<-stopped
+	}
+}
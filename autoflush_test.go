@@ -0,0 +1,70 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_FlushesIncompleteLinePeriodically(t *testing.T) {
+	test := assert.New(t)
+
+	mutex := &sync.Mutex{}
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, mutex, false)
+
+	stop := writer.StartAutoFlush(time.Millisecond)
+	defer stop()
+
+	writer.Write([]byte("1\n2"))
+
+	test.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return buffer.String() == "1\n2"
+	}, time.Second, time.Millisecond)
+}
+
+func TestWriter_StopsAutoFlushOnStop(t *testing.T) {
+	test := assert.New(t)
+
+	mutex := &sync.Mutex{}
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, mutex, false)
+
+	stop := writer.StartAutoFlush(time.Millisecond)
+	stop()
+	stop()
+
+	writer.Write([]byte("1"))
+	time.Sleep(10 * time.Millisecond)
+
+	test.Equal("", buffer.String())
+	test.Equal(1, writer.Buffered())
+}
+
+func TestWriter_StopsAutoFlushOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+
+	stop := writer.StartAutoFlush(time.Millisecond)
+
+	test.NoError(writer.Close())
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		test.Fail("auto flush goroutine is not stopped")
+	}
+}
@@ -0,0 +1,33 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+)
+
+// NewBuffer returns new Writer, that works exactly like one returned by New,
+// but writes into memory instead of backend, and function, that returns copy
+// of everything written so far. It's useful for testing code, that writes
+// into Writer.
+func NewBuffer(
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) (*Writer, func() []byte) {
+	buffer := &bytes.Buffer{}
+	writer := NewFromWriter(buffer, lock, ensureNewline, options...)
+
+	return writer, func() []byte {
+		writer.mutex.Lock()
+		defer writer.mutex.Unlock()
+
+		// Lock can be replaced by SetLock, so current one is used. Lock is
+		// already held while group is started.
+		if writer.group == nil {
+			writer.lock.Lock()
+			defer writer.lock.Unlock()
+		}
+
+		return append([]byte(nil), buffer.Bytes()...)
+	}
+}
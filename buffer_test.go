@@ -0,0 +1,50 @@
+package lineflushwriter
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBuffer_ReturnsCopyOfWrittenLines(t *testing.T) {
+	test := assert.New(t)
+
+	writer, output := NewBuffer(&sync.Mutex{}, true, WithPrefix("> "))
+	test.Empty(output())
+
+	writer.Write([]byte("1\n2"))
+
+	data := output()
+	test.Equal("> 1\n", string(data))
+
+	data[0] = 'x'
+	test.Equal("> 1\n", string(output()))
+
+	writer.Close()
+	test.Equal("> 1\n> 2\n", string(output()))
+}
+
+func TestNewBuffer_ReadsOutputUnderLockSpecifiedBySetLock(t *testing.T) {
+	test := assert.New(t)
+
+	writer, output := NewBuffer(&sync.Mutex{}, false)
+	writer.SetLock(&sync.Mutex{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			writer.Write([]byte("1\n"))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		output()
+	}
+
+	<-done
+
+	test.Len(output(), 200)
+}
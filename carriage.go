@@ -0,0 +1,68 @@
+package lineflushwriter
+
+import "bytes"
+
+const carriageReturn = '\r'
+
+// carriageLineEnd returns position right after the first line terminator in
+// given data or -1 if data has no terminators. Terminator is either delimiter
+// or carriage return, that is neither part of delimiter nor followed by it.
+// Carriage return at the end of data, that can be followed by delimiter, is
+// not considered terminator until it's known what follows it.
+func carriageLineEnd(data []byte, delimiter []byte) int {
+	for i := range data {
+		if bytes.HasPrefix(data[i:], delimiter) {
+			return i + len(delimiter)
+		}
+
+		if data[i] != carriageReturn || bytes.HasPrefix(delimiter, data[i:]) {
+			continue
+		}
+
+		next := data[i+1:]
+
+		if bytes.HasPrefix(next, delimiter) {
+			continue
+		}
+
+		if bytes.HasPrefix(delimiter, next) {
+			return -1
+		}
+
+		return i + 1
+	}
+
+	return -1
+}
+
+// lastCarriageEnd returns position right after the last line terminator in
+// given data or zero if data has no terminators, see carriageLineEnd.
+func lastCarriageEnd(data []byte, delimiter []byte) int {
+	var last int
+
+	for {
+		end := carriageLineEnd(data[last:], delimiter)
+		if end < 0 {
+			return last
+		}
+
+		last += end
+	}
+}
+
+// splitCarriage splits given data into lines, that keep trailing terminator,
+// see carriageLineEnd, and appends them to given lines. Last line can be
+// incomplete.
+func splitCarriage(lines [][]byte, data []byte, delimiter []byte) [][]byte {
+	for len(data) > 0 {
+		end := carriageLineEnd(data, delimiter)
+		if end < 0 {
+			end = len(data)
+		}
+
+		lines = append(lines, data[:end])
+		data = data[end:]
+	}
+
+	return lines
+}
@@ -0,0 +1,123 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_WritesLinesTerminatedWithCarriageReturn(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithCarriageReturnAsLine(true),
+	)
+
+	writer.Write([]byte("50%\r75%"))
+	test.Equal("50%\r", buffer.String())
+
+	writer.Write([]byte("\r"))
+	test.Equal("50%\r", buffer.String())
+
+	writer.Write([]byte("100%\r"))
+	test.Equal("50%\r75%\r", buffer.String())
+
+	writer.Write([]byte("\ndone\r\r\n"))
+	test.Equal("50%\r75%\r100%\r\ndone\r\r\n", buffer.String())
+
+	lines, _ := writer.Stats()
+	test.EqualValues(5, lines)
+}
+
+func TestWriter_DropsCarriageReturnTerminatingLineIfRequested(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithCarriageReturnAsLine(false), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\r2\r\n3\n4\r"))
+	test.Equal("> 1> 2\r\n> 3\n", buffer.String())
+
+	writer.Close()
+	test.Equal("> 1> 2\r\n> 3\n> 4\r\n", buffer.String())
+}
+
+func TestWriter_TreatsCRLFAsSingleTerminatorInCarriageMode(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithCRLF(), WithCarriageReturnAsLine(true), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\r\n2\r3\n\r"))
+	test.Equal("> 1\r\n> 2\r", buffer.String())
+
+	writer.Write([]byte("\n"))
+	test.Equal("> 1\r\n> 2\r> 3\n\r\n", buffer.String())
+}
+
+func TestWriter_DoNotCountPendingCarriageReturnTowardsMaxLineSize(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithCarriageReturnAsLine(true), WithMaxLineBytes(3),
+	)
+
+	writer.Write([]byte("abc\r"))
+	test.Equal("", buffer.String())
+
+	writer.Write([]byte("x\n"))
+	test.Equal("abc\rx\n", buffer.String())
+}
+
+func TestWriter_NormalizesLineTerminators(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithNormalizeNewlines(), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\n2\r\n3\r4\r"))
+	test.Equal("> 1\n> 2\n> 3\n", buffer.String())
+
+	writer.Write([]byte("\n5\r"))
+	test.Equal("> 1\n> 2\n> 3\n> 4\n", buffer.String())
+
+	writer.Write([]byte("6\r"))
+	test.Equal("> 1\n> 2\n> 3\n> 4\n> 5\n", buffer.String())
+
+	writer.Close()
+	test.Equal("> 1\n> 2\n> 3\n> 4\n> 5\n> 6\n", buffer.String())
+}
+
+func TestWriter_KeepsBufferIntactOnNormalizeIfWriteFails(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 0}
+	writer := New(
+		backend, &sync.Mutex{}, false,
+		WithNormalizeNewlines(), WithRetainOnError(),
+	)
+
+	writer.Write([]byte("1\r\n2\r\n"))
+	test.Equal([]byte("1\r\n2\r\n"), writer.Peek())
+
+	backend.limit = 100
+	writer.Close()
+	test.Equal("1\n2\n", backend.String())
+}
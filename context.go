@@ -0,0 +1,38 @@
+package lineflushwriter
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// NewWithContext returns new Writer, that works exactly like one returned by
+// New, but is closed as soon as given context is done, so remaining data is
+// not lost if Writer is not closed explicitly. Watching context is stopped
+// when Writer is closed.
+func NewWithContext(
+	ctx context.Context,
+	backend io.WriteCloser,
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) *Writer {
+	writer := New(backend, lock, ensureNewline, options...)
+
+	stop := context.AfterFunc(ctx, func() {
+		writer.Close()
+	})
+
+	// Context can be already done, so Writer can be closed concurrently.
+	writer.mutex.Lock()
+	if writer.closed {
+		stop()
+	} else {
+		writer.stops = append(writer.stops, func() {
+			stop()
+		})
+	}
+	writer.mutex.Unlock()
+
+	return writer
+}
@@ -0,0 +1,60 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithContext_ClosesWriterWhenContextIsDone(t *testing.T) {
+	test := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	writer := NewWithContext(ctx, backend, &sync.Mutex{}, true)
+
+	writer.Write([]byte("1\n2"))
+	cancel()
+
+	test.Eventually(writer.Closed, time.Second, time.Millisecond)
+	test.True(backend.closed)
+	test.Equal("1\n2\n", backend.String())
+}
+
+func TestNewWithContext_ClosesWriterIfContextIsAlreadyDone(t *testing.T) {
+	test := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	counter := &writeCounter{}
+	writer := NewWithContext(ctx, counter, &sync.Mutex{}, false)
+
+	test.Eventually(writer.Closed, time.Second, time.Millisecond)
+	test.Equal(1, counter.closes)
+	test.NoError(writer.Close())
+}
+
+func TestNewWithContext_StopsWatchingContextOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	counter := &writeCounter{}
+	writer := NewWithContext(ctx, counter, &sync.Mutex{}, false)
+
+	test.NoError(writer.Close())
+
+	writer.Reset(counter)
+	cancel()
+
+	time.Sleep(10 * time.Millisecond)
+	test.False(writer.Closed())
+	test.Equal(1, counter.closes)
+}
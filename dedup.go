@@ -0,0 +1,52 @@
+package lineflushwriter
+
+import "fmt"
+
+// WithDedupConsecutive makes Writer to drop complete line, that is identical
+// to the previous line written into backend, like syslog does with repeated
+// messages. If `summary` is true, summary line "... (repeated N times)" is
+// written when run of repeated lines ends, either by different line or by
+// Close, where N is amount of dropped lines. Summary line gets prefix and
+// other header like any other line. Lines are compared after line
+// processing, but without header, so lines, that differ only by timestamp or
+// line number, are still repeated.
+//
+// Line, that was written into backend partially, e.g. via Flush, is never
+// dropped and is not compared with subsequent lines.
+func WithDedupConsecutive(summary bool) Option {
+	return func(writer *Writer) {
+		writer.dedup = true
+		writer.summary = summary
+	}
+}
+
+// appendRepeated appends summary line for given amount of repeated lines to
+// the output, if there are any and summary is enabled, and returns line number
+// after summary line.
+func (writer *Writer) appendRepeated(
+	output []byte,
+	repeats int,
+	number int,
+) ([]byte, int) {
+	if repeats == 0 || !writer.summary {
+		return output, number
+	}
+
+	output = writer.appendHeader(output, number)
+
+	if writer.numbering {
+		number++
+	}
+
+	if repeats == 1 {
+		output = append(output, "... (repeated 1 time)"...)
+	} else {
+		output = fmt.Appendf(output, "... (repeated %d times)", repeats)
+	}
+
+	if !writer.strip {
+		output = append(output, writer.terminator...)
+	}
+
+	return output, number
+}
@@ -0,0 +1,84 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_DropsRepeatedLinesAcrossWrites(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithDedupConsecutive(true), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("error\nerror\n"))
+	writer.Write([]byte("err"))
+	writer.Write([]byte("or\nerror\n"))
+	test.Equal("> error\n", buffer.String())
+
+	writer.Write([]byte("ok\nok\n"))
+	test.Equal(
+		"> error\n> ... (repeated 3 times)\n> ok\n",
+		buffer.String(),
+	)
+
+	test.NoError(writer.Close())
+	test.Equal(
+		"> error\n> ... (repeated 3 times)\n> ok\n"+
+			"> ... (repeated 1 time)\n",
+		buffer.String(),
+	)
+}
+
+func TestWriter_DoNotDropLineRepeatingPartiallyWrittenLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithDedupConsecutive(true))
+
+	writer.Write([]byte("1\n1\n1"))
+	writer.Flush()
+	test.Equal("1\n... (repeated 1 time)\n1", buffer.String())
+
+	writer.Write([]byte("\n1\n2"))
+	writer.Close()
+	test.Equal("1\n... (repeated 1 time)\n1\n1\n2", buffer.String())
+}
+
+func TestWriter_WritesLinesAgainAfterErrorOnDedup(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+	writer := New(backend, nil, false, WithDedupConsecutive(true))
+
+	writer.Write([]byte("1\n"))
+	writer.Write([]byte("1\n2\n"))
+	test.Equal("1\n", backend.String())
+
+	backend.limit = 100
+
+	writer.Write([]byte("1\n1\n"))
+	test.Equal("1\n1\n", backend.String())
+
+	test.NoError(writer.Close())
+	test.Equal("1\n1\n... (repeated 1 time)\n", backend.String())
+}
+
+func TestWriter_DropsRepeatedLinesWithoutSummary(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithDedupConsecutive(false),
+	)
+
+	writer.Write([]byte("1\n1\n1\n2\n2\n"))
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n", buffer.String())
+}
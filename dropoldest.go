@@ -0,0 +1,55 @@
+package lineflushwriter
+
+// WithDropOldest makes Writer to keep at most `maxLines` complete lines in
+// the buffer, while they can't be written into backend, e.g. due to backend
+// errors with WithRetainOnError or during batching with WithBatchBytes. When
+// new complete line exceeds the limit, the oldest buffered line is dropped,
+// so memory is bounded and recent lines are delivered as soon as backend
+// recovers. It sacrifices completeness of output for liveness. Dropped lines
+// are reported by Dropped. Zero means no limit.
+//
+// Line, which beginning was already written into backend, is never dropped.
+func WithDropOldest(maxLines int) Option {
+	return func(writer *Writer) {
+		writer.maxQueued = maxLines
+	}
+}
+
+// dropOldest drops the oldest complete lines from the buffer, which exceed
+// limit specified by WithDropOldest.
+func (writer *Writer) dropOldest() {
+	if writer.maxQueued == 0 {
+		return
+	}
+
+	var (
+		start = 0
+		lines = writer.splitLines(
+			writer.split[:0],
+			writer.buffer[:writer.lastLineEnd()],
+		)
+	)
+
+	defer clear(lines)
+
+	// Rest of the line, that was written into backend, is kept.
+	if writer.midline && len(lines) > 0 {
+		start = len(lines[0])
+		lines = lines[1:]
+	}
+
+	excess := len(lines) - writer.maxQueued
+	if excess <= 0 {
+		return
+	}
+
+	size := 0
+	for _, line := range lines[:excess] {
+		size += len(line)
+	}
+
+	copy(writer.buffer[start:], writer.buffer[start+size:])
+	writer.truncate(len(writer.buffer) - size)
+
+	writer.dropped += uint64(excess)
+}
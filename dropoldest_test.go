@@ -0,0 +1,53 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_DropsOldestLinesWhileBackendIsStalled(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 0}
+	writer := New(
+		backend, &sync.Mutex{}, false,
+		WithRetainOnError(), WithDropOldest(2),
+	)
+
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n", "5"} {
+		writer.Write([]byte(line))
+	}
+
+	test.Equal([]byte("3\n4\n5"), writer.Peek())
+	test.EqualValues(2, writer.Dropped())
+
+	backend.limit = 100
+	writer.Write([]byte("\n"))
+	test.Equal("3\n4\n5\n", backend.String())
+	test.EqualValues(2, writer.Dropped())
+}
+
+func TestWriter_KeepsLineStartedInBackendOnDropOldest(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	writer := New(
+		backend, &sync.Mutex{}, false,
+		WithRetainOnError(), WithDropOldest(1),
+	)
+
+	writer.Write([]byte("1"))
+	writer.Flush()
+
+	backend.limit = 1
+	writer.Write([]byte("2\n3\n4\n"))
+	test.Equal([]byte("2\n4\n"), writer.Peek())
+	test.EqualValues(1, writer.Dropped())
+
+	backend.limit = 100
+	writer.Flush()
+	test.Equal("12\n4\n", backend.String())
+}
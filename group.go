@@ -0,0 +1,47 @@
+package lineflushwriter
+
+// BeginGroup acquires lock, that is shared between writers, and holds it
+// until EndGroup is called, so complete lines of all write calls between
+// BeginGroup and EndGroup are contiguous in backend, e.g. lines of stack
+// trace, that is written by several write calls. Writers sharing the same
+// lock wait until group is ended, so group should be short.
+//
+// Returned function ends the group and can be deferred, so group is ended
+// even if EndGroup is forgotten. Groups are not nested: BeginGroup does
+// nothing if group is already started. Group is ended by Close and Detach
+// too. Incomplete line, that is left in the buffer when group is ended, is
+// not part of the group.
+func (writer *Writer) BeginGroup() (end func()) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.group == nil && !writer.closed {
+		writer.lock.Lock()
+
+		writer.group = writer.lock
+		writer.lock = nopLocker{}
+	}
+
+	return writer.EndGroup
+}
+
+// EndGroup ends group started by BeginGroup and releases lock, that is shared
+// between writers. It does nothing if group is not started.
+func (writer *Writer) EndGroup() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.endGroup()
+}
+
+// endGroup releases lock held by group, if any.
+func (writer *Writer) endGroup() {
+	if writer.group == nil {
+		return
+	}
+
+	writer.lock = writer.group
+	writer.group = nil
+
+	writer.lock.Unlock()
+}
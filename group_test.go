@@ -0,0 +1,82 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_WritesGroupedLinesContiguously(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		lock    = &sync.Mutex{}
+		buffer  = &bytes.Buffer{}
+		grouped = New(nopCloser{buffer}, lock, false)
+		other   = New(nopCloser{buffer}, lock, false)
+		done    = make(chan struct{})
+		wg      = sync.WaitGroup{}
+	)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			default:
+				other.Write([]byte("other\n"))
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		func() {
+			defer grouped.BeginGroup()()
+
+			grouped.Write([]byte("panic: error\n"))
+			grouped.Write([]byte("\tmain.go:1\n"))
+			grouped.Write([]byte("\tmain.go:2\n"))
+		}()
+	}
+
+	close(done)
+	wg.Wait()
+
+	test.Equal(
+		100,
+		strings.Count(
+			buffer.String(),
+			"panic: error\n\tmain.go:1\n\tmain.go:2\n",
+		),
+	)
+}
+
+func TestWriter_EndsGroupOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		lock   = &sync.Mutex{}
+		buffer = &bytes.Buffer{}
+		writer = New(nopCloser{buffer}, lock, true)
+	)
+
+	writer.BeginGroup()
+	writer.BeginGroup()
+	writer.Write([]byte("1\n2"))
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n", buffer.String())
+
+	test.True(lock.TryLock())
+	lock.Unlock()
+
+	writer.EndGroup()
+}
@@ -0,0 +1,90 @@
+package lineflushwriter
+
+import "sync"
+
+// LineGuard coordinates writers, that share the same backend, so lines of one
+// writer never get into the middle of incomplete line, that was forcibly
+// written into backend by another writer, e.g. via Flush. Such incomplete line
+// is terminated with delimiter of its writer first and rest of that line is
+// written later as a new line.
+//
+// LineGuard also serves as the lock, that is shared between writers, so it
+// replaces lock specified by WithLock.
+type LineGuard struct {
+	sync.Mutex
+
+	// owner is the writer, that has incomplete line written into backend.
+	owner *Writer
+}
+
+// NewLineGuard returns new LineGuard, that can be passed to writers via
+// WithLineGuard.
+func NewLineGuard() *LineGuard {
+	return &LineGuard{}
+}
+
+// WithLineGuard makes Writer to be coordinated with other writers via given
+// guard.
+func WithLineGuard(guard *LineGuard) Option {
+	return func(writer *Writer) {
+		writer.lock = guard
+		writer.guard = guard
+	}
+}
+
+// guardLine terminates incomplete line, that was written into backend by
+// another writer sharing the same guard. Lock should be held by caller.
+func (writer *Writer) guardLine() error {
+	guard := writer.guard
+	if guard == nil {
+		return nil
+	}
+
+	if guard.owner != nil && guard.owner != writer {
+		_, err := writer.writeBackend(guard.owner.terminator)
+		if err != nil {
+			return err
+		}
+
+		guard.owner = nil
+	}
+
+	// Own incomplete line was terminated by another writer.
+	if guard.owner != writer {
+		writer.midline = false
+	}
+
+	return nil
+}
+
+// trackLine remembers in guard, whether writer has incomplete line written
+// into backend. Lock should be held by caller.
+func (writer *Writer) trackLine() {
+	guard := writer.guard
+	if guard == nil {
+		return
+	}
+
+	if writer.midline {
+		guard.owner = writer
+	} else if guard.owner == writer {
+		guard.owner = nil
+	}
+}
+
+// syncLine forgets own incomplete line, that was written into backend, if it
+// was already terminated by another writer sharing the same guard, so it's
+// not terminated twice. Mutex should be held by caller.
+func (writer *Writer) syncLine() {
+	if writer.guard == nil || !writer.midline {
+		return
+	}
+
+	// Lock is already held while group is started.
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	if writer.guard.owner != writer {
+		writer.midline = false
+	}
+}
@@ -0,0 +1,116 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineGuard_TerminatesIncompleteLineOfAnotherWriter(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		guard  = NewLineGuard()
+		buffer = &bytes.Buffer{}
+		stdout = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+		stderr = NewWriter(
+			nopCloser{buffer},
+			WithLineGuard(guard),
+			WithPrefix("! "),
+		)
+	)
+
+	stdout.Write([]byte("1\nprompt: "))
+	stdout.Flush()
+	stderr.Write([]byte("error\n"))
+	stdout.Write([]byte("2\n"))
+
+	test.Equal("1\nprompt: \n! error\n2\n", buffer.String())
+}
+
+func TestLineGuard_DoNotTerminateOwnIncompleteLine(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		guard  = NewLineGuard()
+		buffer = &bytes.Buffer{}
+		stdout = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+		stderr = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+	)
+
+	stdout.Write([]byte("prompt: "))
+	stdout.Flush()
+	stdout.Write([]byte("42\n"))
+	stderr.Write([]byte("error\n"))
+
+	test.Equal("prompt: 42\nerror\n", buffer.String())
+}
+
+func TestLineGuard_PrependsPrefixToRestOfTerminatedLine(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		guard  = NewLineGuard()
+		buffer = &bytes.Buffer{}
+		stdout = NewWriter(
+			nopCloser{buffer},
+			WithLineGuard(guard),
+			WithPrefix("> "),
+		)
+		stderr = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+	)
+
+	stdout.Write([]byte("1"))
+	stdout.Flush()
+	stderr.Write([]byte("error\n"))
+	stdout.Write([]byte("2\n"))
+
+	test.Equal("> 1\nerror\n> 2\n", buffer.String())
+}
+
+func TestLineGuard_DoNotTerminateLineTerminatedByAnotherWriterOnClose(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	var (
+		guard  = NewLineGuard()
+		buffer = &bytes.Buffer{}
+		stdout = NewWriter(
+			nopCloser{buffer},
+			WithLineGuard(guard),
+			WithEnsureNewline(true),
+		)
+		stderr = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+	)
+
+	stdout.Write([]byte("aaa\nb"))
+	stdout.Flush()
+	stderr.Write([]byte("c\n"))
+	stdout.Close()
+
+	test.Equal("aaa\nb\nc\n", buffer.String())
+}
+
+func TestLineGuard_DoNotForceLineTerminatedByAnotherWriter(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		guard  = NewLineGuard()
+		buffer = &bytes.Buffer{}
+		stdout = NewWriter(
+			nopCloser{buffer},
+			WithLineGuard(guard),
+			WithForceLinePerWrite(),
+		)
+		stderr = NewWriter(nopCloser{buffer}, WithLineGuard(guard))
+	)
+
+	stdout.Write([]byte("aaa\nb"))
+	stdout.Flush()
+	stderr.Write([]byte("c\n"))
+	stdout.Write([]byte("d\n"))
+
+	test.Equal("aaa\nb\nc\nd\n", buffer.String())
+}
@@ -0,0 +1,90 @@
+package lineflushwriter
+
+import "bytes"
+
+// jsonState describes position in JSON text, that is required to tell whether
+// delimiter terminates JSON record or not.
+type jsonState struct {
+	depth   int
+	quoted  bool
+	escaped bool
+}
+
+// next returns state after given byte.
+func (state jsonState) next(char byte) jsonState {
+	switch {
+	case state.escaped:
+		state.escaped = false
+
+	case state.quoted && char == '\\':
+		state.escaped = true
+
+	case char == '"':
+		state.quoted = !state.quoted
+
+	case state.quoted:
+
+	case char == '{' || char == '[':
+		state.depth++
+
+	case (char == '}' || char == ']') && state.depth > 0:
+		state.depth--
+	}
+
+	return state
+}
+
+// balanced returns true if all objects, arrays and strings are closed.
+func (state jsonState) balanced() bool {
+	return state.depth == 0 && !state.quoted
+}
+
+// scanRecords scans given data in given state starting from `offset` and
+// returns state at the end of data and position right after the last
+// delimiter, that terminates JSON record, or -1 if there is no such
+// delimiter. State should describe position at `offset`.
+func scanRecords(
+	data []byte,
+	offset int,
+	state jsonState,
+	delimiter []byte,
+) (jsonState, int) {
+	last := -1
+
+	for i := offset; i < len(data); i++ {
+		state = state.next(data[i])
+
+		if state.balanced() && bytes.HasSuffix(data[:i+1], delimiter) {
+			last = i + 1
+		}
+	}
+
+	return state, last
+}
+
+// splitRecords splits given data, that begins in given state, into JSON
+// records, that keep trailing delimiter, and appends them to given records.
+// Last record can be incomplete.
+func splitRecords(
+	records [][]byte,
+	data []byte,
+	state jsonState,
+	delimiter []byte,
+) [][]byte {
+	var start int
+
+	for i := range data {
+		state = state.next(data[i])
+
+		if state.balanced() && bytes.HasSuffix(data[start:i+1], delimiter) {
+			records = append(records, data[start:i+1])
+			start = i + 1
+		}
+	}
+
+	if start < len(data) {
+		records = append(records, data[start:])
+	}
+
+	return records
+}
@@ -0,0 +1,58 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_DoNotSplitJSONRecordAtNewlineInsideString(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithJSONLineMode(),
+	)
+
+	writer.Write([]byte("{\"a\": \"1\n2\"}\n{\"b\": [\n"))
+	test.Equal("{\"a\": \"1\n2\"}\n", buffer.String())
+
+	writer.Write([]byte("\"\\\"}\n\"]}\n"))
+	test.Equal("{\"a\": \"1\n2\"}\n{\"b\": [\n\"\\\"}\n\"]}\n", buffer.String())
+
+	lines, _ := writer.Stats()
+	test.EqualValues(2, lines)
+}
+
+func TestWriter_PrependsPrefixToEveryJSONRecord(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithJSONLineMode(), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("{\"a\": \"\n\"}\n{"))
+	writer.Flush()
+	writer.Write([]byte("\"b\": \"\n\"}\ntext\n"))
+	test.Equal(
+		"> {\"a\": \"\n\"}\n> {\"b\": \"\n\"}\n> text\n",
+		buffer.String(),
+	)
+}
+
+func TestWriter_WritesTextWithoutBracketsAsLinesInJSONLineMode(
+	t *testing.T,
+) {
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithJSONLineMode(),
+	)
+
+	testWriter(t, writer, false, "1\n2", "1\n")
+	testWriter(t, writer, false, "\n", "1\n2\n")
+}
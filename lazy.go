@@ -0,0 +1,51 @@
+package lineflushwriter
+
+import (
+	"io"
+	"sync"
+)
+
+// NewLazy returns new Writer, that works exactly like one returned by New,
+// but obtains backend by calling `factory` right before the first data is
+// written into backend, so, e.g., file is not created if nothing is ever
+// written. If nothing was written, factory is not called on Close either.
+//
+// Error returned by factory is returned from writing method or Close, that
+// triggered the call, and factory is called again on next write. Backend
+// returned by factory is not exposed to Writer, so Sync, Fd and
+// SetWriteDeadline do not reach it.
+func NewLazy(
+	factory func() (io.WriteCloser, error),
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) *Writer {
+	return New(&lazyBackend{factory: factory}, lock, ensureNewline, options...)
+}
+
+// lazyBackend implements io.WriteCloser, that opens backend on first write.
+type lazyBackend struct {
+	factory func() (io.WriteCloser, error)
+	backend io.WriteCloser
+}
+
+func (lazy *lazyBackend) Write(data []byte) (int, error) {
+	if lazy.backend == nil {
+		backend, err := lazy.factory()
+		if err != nil {
+			return 0, err
+		}
+
+		lazy.backend = backend
+	}
+
+	return lazy.backend.Write(data)
+}
+
+func (lazy *lazyBackend) Close() error {
+	if lazy.backend == nil {
+		return nil
+	}
+
+	return lazy.backend.Close()
+}
@@ -0,0 +1,76 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLazy_DoesNotCallFactoryIfNothingIsWritten(t *testing.T) {
+	test := assert.New(t)
+
+	calls := 0
+	writer := NewLazy(func() (io.WriteCloser, error) {
+		calls++
+		return &writeCounter{}, nil
+	}, &sync.Mutex{}, true)
+
+	writer.Write([]byte{})
+	test.NoError(writer.Close())
+	test.Equal(0, calls)
+}
+
+func TestNewLazy_CallsFactoryOnFirstWrittenLine(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		calls   = 0
+		backend = &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	)
+
+	writer := NewLazy(func() (io.WriteCloser, error) {
+		calls++
+		return backend, nil
+	}, &sync.Mutex{}, true)
+
+	writer.Write([]byte("1"))
+	test.Equal(0, calls)
+
+	writer.Write([]byte("\n2"))
+	writer.Write([]byte("\n3"))
+	test.Equal(1, calls)
+	test.Equal("1\n2\n", backend.String())
+
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n3\n", backend.String())
+	test.True(backend.closed)
+}
+
+func TestNewLazy_ReturnsFactoryError(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		expected = errors.New("unable to open")
+		calls    = 0
+	)
+
+	writer := NewLazy(func() (io.WriteCloser, error) {
+		calls++
+		return nil, expected
+	}, &sync.Mutex{}, false)
+
+	_, err := writer.Write([]byte("1\n"))
+	test.True(errors.Is(err, expected))
+	test.Equal(1, calls)
+
+	writer.Write([]byte("2"))
+
+	err = writer.Close()
+	test.True(errors.Is(err, expected))
+	test.True(errors.Is(err, ErrFlush))
+	test.Equal(2, calls)
+}
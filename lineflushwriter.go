@@ -2,76 +2,2559 @@ package lineflushwriter
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrClosed is returned on attempt to write into already closed Writer.
+	ErrClosed = errors.New("lineflushwriter: writer is closed")
+
+	// ErrFlush is wrapped by error returned from Close if remaining data was
+	// not written into backend.
+	ErrFlush = errors.New("lineflushwriter: unable to flush remaining data")
+
+	// ErrCloseBackend is wrapped by error returned from Close if backend was
+	// not closed successfully.
+	ErrCloseBackend = errors.New("lineflushwriter: unable to close backend")
+
+	// ErrOutputLimitExceeded is returned by writing methods if amount of
+	// bytes written into backend reached limit specified by
+	// WithMaxTotalBytes.
+	ErrOutputLimitExceeded = errors.New(
+		"lineflushwriter: output limit exceeded",
+	)
+
+	// ErrNilBackend is returned by NewChecked if backend is nil.
+	ErrNilBackend = errors.New("lineflushwriter: backend is nil")
+
+	// ErrAmbiguousDelimiter is returned by SetDelimiter if buffered
+	// incomplete line contains new delimiter.
+	ErrAmbiguousDelimiter = errors.New(
+		"lineflushwriter: buffered data contains new delimiter",
+	)
+)
+
+const (
+	readChunkSize   = 32 * 1024
+	lineNumberWidth = 4
+)
+
+var errInvalidWrite = errors.New(
+	"lineflushwriter: backend returned invalid count of written bytes",
 )
 
 // Writer implements writer, that will proxy to specified `backend` writer only
 // complete lines, e.g. that ends in newline. This writer is thread-safe.
+//
+// Writer state is guarded by own mutex, while `lock` is held only during
+// writes into backend, so writers sharing the same lock do not wait for each
+// other unless they have complete lines to write.
+//
+// Writers sharing the same lock and backend guarantee, that:
+//
+//   - complete line is never split or interleaved with data of other
+//     writers, no matter how many write calls it was written by, unless
+//     incomplete line is forcibly written by Flush, max buffer size or Close;
+//   - all complete lines passed to single write call are written at once,
+//     so they are contiguous in backend;
+//   - lines of one writer are written in the order they were written into
+//     Writer, while there is no ordering between lines of different writers
+//     except that write call, which returned, happens before lines of write
+//     calls, that started after it.
 type Writer struct {
+	mutex   sync.Locker
 	lock    sync.Locker
-	backend io.WriteCloser
+	backend io.Writer
 	buffer  []byte
+	shrink  int
+
+	// peak is the largest length of the buffer ever reached.
+	peak int
+
+	// scratch, pieces, spans and split are reused by writeLines, so
+	// processing of lines doesn't allocate memory.
+	scratch []byte
+	pieces  []piece
+	spans   []span
+	split   [][]byte
 
+	// scanned is the length of the part of the buffer, that was searched for
+	// line ends, and ended is the position right after the last line end in
+	// that part.
+	scanned int
+	ended   int
+
+	newline       rune
 	ensureNewline bool
+	ensureAlways  bool
+	delimiters    []byte
+	terminator    []byte
+	soft          []byte
+
+	// terminated is true if delimiter at the end of the buffer was added on
+	// close, so it's written even if delimiters are stripped.
+	strip      bool
+	terminated bool
+
+	carriage     bool
+	keepCarriage bool
+	normalize    bool
+
+	tee       io.Writer
+	teeErrors bool
+	router    func(line []byte) io.Writer
+
+	// preamble is the part of preamble, that is not written yet.
+	preamble []byte
+
+	header    []byte
+	headed    bool
+	trailer   []byte
+	marker    []byte
+	dirty     bool
+	prefix    []byte
+	timestamp string
+	clock     func() time.Time
+	lineFunc  func([]byte) []byte
+	stripANSI bool
+	sanitize  bool
+	trimSpace bool
+
+	// replacement is the encoded rune, that replaces invalid UTF-8
+	// sequences, or nil if lines are not validated.
+	replacement []byte
+
+	midline   bool
+	numbering bool
+	number    int
+
+	// numberWidth is the width of the widest line number written so far.
+	numberWidth int
+
+	collapse bool
+	blank    bool
+
+	// last is the last complete line, that was written into backend, and
+	// repeats is the amount of lines, that were identical to it and were not
+	// written, see WithDedupConsecutive, which also specifies summary.
+	dedup   bool
+	summary bool
+	last    []byte
+	repeats int
+
+	// rewound is true if incomplete line at the beginning of the buffer was
+	// written into backend by FlushPartial, so it should be rewritten after
+	// carriage return.
+	rewound bool
+
+	limiter   *rateLimiter
+	dropping  bool
+	dropped   uint64
+	maxQueued int
+
+	// queuePolicy is used only by backend of writer returned by NewAsync.
+	queuePolicy QueueFullPolicy
+
+	retain         bool
+	batch          int
+	sticky         bool
+	failure        error
+	maxBuffer      int
+	chunkSize      int
+	maxLine        int
+	column         int
+	discardPartial bool
+	maxTotal       int64
+	forceLine      bool
+
+	// ctx is context of current WriteContext call, that can be done, or nil.
+	ctx context.Context
+
+	// byteRun is true if the last write call was WriteByte, so consecutive
+	// bytes are treated as single write by WithForceLinePerWrite.
+	byteRun bool
+
+	// record is the JSON state at the beginning of the buffer and
+	// scannedRecord is the JSON state right after scanned part of the buffer.
+	jsonLines     bool
+	record        jsonState
+	scannedRecord jsonState
+
+	closed bool
+	stops  []func()
+	guard  *LineGuard
+
+	// keepBackend is true if backend should not be closed, see
+	// WithoutBackendClose.
+	keepBackend bool
+
+	// group is the lock, that is held by BeginGroup, while lock is replaced
+	// with nopLocker.
+	group sync.Locker
+
+	closeHook   func(flushed int, err error)
+	partialHook func(partial []byte)
+	observer    func(size int)
+	timingHook  func(duration time.Duration, written int)
+
+	deadline    time.Time
+	hasDeadline bool
+
+	// Counters are atomic, so they can be read without waiting for writes.
+	lines atomic.Uint64
+	bytes atomic.Uint64
 }
 
 // New returns new Writer, that will proxy data to the `backend` writer,
 // thread-safety is guaranteed via `lock`. Optionally, writer can ensure, that
-// last line of output ends with newline, if `ensureNewline` is true.
+// last line of output ends with newline, if `ensureNewline` is true. If
+// other delimiter is specified by options, last line is terminated with that
+// delimiter instead.
+//
+// If `lock` is nil, writer uses own mutex. New panics if `writer` is nil, use
+// NewChecked to get an error instead.
 func New(
 	writer io.WriteCloser,
 	lock sync.Locker,
 	ensureNewline bool,
+	options ...Option,
+) *Writer {
+	checked, err := NewChecked(writer, lock, ensureNewline, options...)
+	if err != nil {
+		panic(err)
+	}
+
+	return checked
+}
+
+// NewChecked returns new Writer, that works exactly like one returned by New,
+// but returns ErrNilBackend instead of panic if `writer` is nil.
+func NewChecked(
+	writer io.WriteCloser,
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) (*Writer, error) {
+	if writer == nil {
+		return nil, ErrNilBackend
+	}
+
+	return NewWriter(
+		writer,
+		append(
+			[]Option{WithLock(lock), WithEnsureNewline(ensureNewline)},
+			options...,
+		)...,
+	), nil
+}
+
+// NewWithDelimiter returns new Writer, that works exactly like one returned by
+// New, but treats `delimiter` as line terminator instead of newline.
+// Non-ASCII delimiter is matched by its UTF-8 encoding.
+func NewWithDelimiter(
+	writer io.WriteCloser,
+	lock sync.Locker,
+	ensureNewline bool,
+	delimiter rune,
+	options ...Option,
 ) *Writer {
-	return &Writer{
-		backend: writer,
-		lock:    lock,
+	return New(
+		writer,
+		lock,
+		ensureNewline,
+		append([]Option{WithDelimiter(delimiter)}, options...)...,
+	)
+}
+
+// NewWriter returns new Writer, that will proxy data to the `backend` writer
+// and is configured by given options. Unless lock is specified via WithLock,
+// writer uses own mutex.
+func NewWriter(backend io.WriteCloser, options ...Option) *Writer {
+	return newWriter(backend, options...)
+}
+
+// NewFromWriter returns new Writer, that works exactly like one returned by
+// New, but accepts backend, that not necessary implements io.Closer. Backend
+// will be closed on Close only if it implements io.Closer.
+func NewFromWriter(
+	writer io.Writer,
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) *Writer {
+	return newWriter(
+		writer,
+		append(
+			[]Option{WithLock(lock), WithEnsureNewline(ensureNewline)},
+			options...,
+		)...,
+	)
+}
 
-		ensureNewline: ensureNewline,
+func newWriter(backend io.Writer, options ...Option) *Writer {
+	writer := &Writer{
+		backend: backend,
+		newline: '\n',
+		clock:   time.Now,
 	}
+
+	for _, option := range options {
+		option(writer)
+	}
+
+	if writer.lock == nil {
+		writer.lock = &sync.Mutex{}
+	}
+
+	if writer.mutex == nil {
+		writer.mutex = &sync.Mutex{}
+	}
+
+	writer.terminator = writer.delimiter()
+
+	return writer
 }
 
 // Writer writes data into Writer.
 //
-// Signature matches with io.Writer's Write().
+// All complete lines from single call are written into backend at once by
+// single backend write, so they are never interleaved with lines of other
+// writers sharing the same lock. Prefix and other per-line options are
+// applied to every line before lines are joined.
+//
+// In particular, write call, that contains single complete line, like
+// log/slog record, produces exactly one backend write if there is no
+// buffered incomplete line and header is already written.
+//
+// Signature matches with io.Writer's Write(). In case of backend error
+// returned count is the number of bytes from data that were actually written
+// into backend, unless WithRetainOnError was specified.
+//
+// Backend error is wrapped with number of line, which was not written, and
+// its offset within data of the call, like "flush line 3 (offset 5): ...", so
+// original error can still be matched by errors.Is. Data, that was buffered
+// by previous calls, is not counted, while Flush and Close count from the
+// beginning of flushed data.
 func (writer *Writer) Write(data []byte) (int, error) {
-	writer.lock.Lock()
+	return writer.WriteContext(context.Background(), data)
+}
+
+// WriteContext works like Write, but returns context error if given context
+// is done by the time complete lines are about to be written. Context is
+// checked before every line, so lines are written into backend one by one if
+// context can be done, and lines, that follow cancellation, are handled like
+// lines, that were not written due to backend error.
+func (writer *Writer) WriteContext(
+	ctx context.Context,
+	data []byte,
+) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if ctx.Done() != nil {
+		writer.ctx = ctx
+		defer func() {
+			writer.ctx = nil
+		}()
+	}
+
+	return writer.writeData(ctx, data)
+}
+
+// WriteLines works like Write, but also returns amount of complete lines,
+// that were written into backend during the call.
+func (writer *Writer) WriteLines(data []byte) (int, int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	lines := writer.lines.Load()
+
+	written, err := writer.writeData(context.Background(), data)
+
+	return written, int(writer.lines.Load() - lines), err
+}
+
+// writeData appends given data to the buffer and writes complete lines into
+// backend.
+func (writer *Writer) writeData(
+	ctx context.Context,
+	data []byte,
+) (int, error) {
+	if err := writer.writable(); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	if len(writer.buffer) == 0 && writer.writesDirectly() {
+		return writer.writeDirectly(data)
+	}
+
+	if writer.forceLine {
+		writer.terminatePartial()
+	}
+
+	writer.byteRun = false
+
+	var pending = len(writer.buffer)
+
 	writer.buffer = append(writer.buffer, data...)
-	defer writer.lock.Unlock()
 
-	var last = bytes.LastIndexByte(writer.buffer, '\n') + 1
+	return writer.flushLines(pending)
+}
 
-	if last > 0 {
-		written, err := writer.backend.Write(writer.buffer[:last])
-		if err != nil {
-			return written, err
-		}
+// writable returns error if data can't be written into Writer.
+func (writer *Writer) writable() error {
+	switch {
+	case writer.closed:
+		return ErrClosed
 
-		writer.buffer = writer.buffer[last:]
+	case writer.failure != nil:
+		return writer.failure
+
+	case writer.exceeded():
+		return ErrOutputLimitExceeded
 	}
 
-	return len(data), nil
+	return nil
 }
 
-// Close flushes all remaining data and closes underlying backend writer.
-// If `ensureNewLine` was specified and remaining data does not ends with
-// newline, then newline will be added.
+// WriteString writes string into Writer without converting it into byte
+// slice.
 //
-// Signature matches with io.WriteCloser's Close().
-func (writer *Writer) Close() error {
-	if writer.ensureNewline && len(writer.buffer) > 0 {
-		if writer.buffer[len(writer.buffer)-1] != '\n' {
-			writer.buffer = append(writer.buffer, '\n')
-		}
+// Signature matches with io.StringWriter's WriteString().
+func (writer *Writer) WriteString(data string) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if err := writer.writable(); err != nil {
+		return 0, err
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	if writer.forceLine {
+		writer.terminatePartial()
+	}
+
+	writer.byteRun = false
+
+	var pending = len(writer.buffer)
+
+	writer.buffer = append(writer.buffer, data...)
+
+	return writer.flushLines(pending)
+}
+
+// WriteByte writes single byte into Writer. Only the new byte is searched
+// for line end, so writing long line byte by byte takes linear time.
+// Consecutive WriteByte calls are treated as single write call by
+// WithForceLinePerWrite.
+//
+// Signature matches with io.ByteWriter's WriteByte().
+func (writer *Writer) WriteByte(char byte) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if err := writer.writable(); err != nil {
+		return err
 	}
 
-	if len(writer.buffer) > 0 {
-		_, err := writer.backend.Write(writer.buffer)
+	if writer.forceLine && !writer.byteRun {
+		writer.terminatePartial()
+	}
+
+	writer.byteRun = true
+
+	var pending = len(writer.buffer)
+
+	writer.buffer = append(writer.buffer, char)
+
+	_, err := writer.flushLines(pending)
+
+	return err
+}
+
+// ReadFrom reads data from given reader until EOF or error and writes it into
+// Writer, so output is the same as it would be with repeated Write calls.
+// Reading is performed without holding any locks.
+//
+// Signature matches with io.ReaderFrom's ReadFrom().
+func (writer *Writer) ReadFrom(reader io.Reader) (int64, error) {
+	var (
+		chunk = make([]byte, readChunkSize)
+		total int64
+	)
+
+	for {
+		read, err := reader.Read(chunk)
+		if read > 0 {
+			total += int64(read)
+
+			_, err := writer.Write(chunk[:read])
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if err == io.EOF {
+			return total, nil
+		}
+
 		if err != nil {
-			return err
+			return total, err
 		}
 	}
+}
+
+// PendingPartial returns true if Writer holds incomplete line, that does not
+// end with delimiter.
+func (writer *Writer) PendingPartial() bool {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return len(writer.buffer) > writer.lastLineEnd()
+}
+
+// Flush writes all buffered data, including incomplete line, into backend
+// writer without closing it.
+//
+// Flush is serialized with write calls by Writer mutex, so it's performed
+// either entirely before or entirely after concurrent write call and never
+// writes part of data of that call.
+func (writer *Writer) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	return writer.flush()
+}
+
+// FlushPartial works like Flush, but keeps incomplete line in the buffer
+// after writing it into backend. When Writer writes that line again, e.g.
+// because it's complete, carriage return is written right before it, so
+// whole line, including prefix, replaces the incomplete one instead of being
+// written after it. It's useful for showing prompts and progress, while
+// line is still being written.
+//
+// Backend is assumed to be a terminal, that moves cursor to the beginning of
+// line on carriage return and overwrites previous output. Output of other
+// backends contains both incomplete line and whole line separated by
+// carriage return. New data should not be shorter than incomplete line,
+// since rest of incomplete line is not erased.
+func (writer *Writer) FlushPartial() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	err := writer.drain()
+	if err != nil {
+		return err
+	}
+
+	var size = writer.flushableEnd()
+
+	if size == 0 {
+		return nil
+	}
+
+	// Line is going to be written again, so it's still not started.
+	var (
+		midline = writer.midline
+		number  = writer.number
+		column  = writer.column
+	)
+
+	written, err := writer.write(writer.buffer[:size], 0)
+
+	writer.midline = midline
+	writer.number = number
+	writer.column = column
+
+	if written > 0 {
+		writer.rewound = true
+	}
+
+	return err
+}
+
+// Drain writes all complete lines, that are buffered, into backend, keeping
+// incomplete line in the buffer. Complete lines are buffered only if they
+// were not written due to backend error, see WithRetainOnError.
+func (writer *Writer) Drain() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	return writer.drain()
+}
+
+// DrainOpts specifies options of the single DrainWithOpts or FlushWithOpts
+// call.
+type DrainOpts struct {
+	// StripDelimiter makes lines to be written without trailing delimiter,
+	// like WithStripDelimiter does. It takes precedence over
+	// WithStripDelimiter, so delimiter is retained if it's false.
+	StripDelimiter bool
+}
+
+// DrainWithOpts works like Drain, but writes lines according to given
+// options instead of corresponding options of Writer.
+func (writer *Writer) DrainWithOpts(opts DrainOpts) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	defer writer.applyOpts(opts)()
+
+	return writer.drain()
+}
+
+// FlushWithOpts works like Flush, but writes lines according to given
+// options instead of corresponding options of Writer.
+func (writer *Writer) FlushWithOpts(opts DrainOpts) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	defer writer.applyOpts(opts)()
+
+	return writer.flush()
+}
+
+// applyOpts applies given options to Writer and returns function, that
+// restores previous configuration.
+func (writer *Writer) applyOpts(opts DrainOpts) (restore func()) {
+	strip := writer.strip
+
+	writer.strip = opts.StripDelimiter
+
+	return func() {
+		writer.strip = strip
+	}
+}
+
+// drain writes all buffered complete lines into backend.
+func (writer *Writer) drain() error {
+	if writer.failure != nil {
+		return writer.failure
+	}
+
+	var size = writer.lastLineEnd()
+
+	if size == 0 {
+		return nil
+	}
+
+	written, err := writer.write(writer.buffer[:size], 0)
+
+	writer.discard(written)
+
+	return err
+}
+
+// Sync works like Flush, but also commits backend contents to stable storage
+// if backend implements Sync() method, like *os.File does.
+func (writer *Writer) Sync() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	err := writer.flush()
+	if err != nil {
+		return err
+	}
+
+	if syncer, ok := writer.backend.(interface{ Sync() error }); ok {
+		writer.lock.Lock()
+		defer writer.lock.Unlock()
+
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// flush writes all buffered data, that can be written, into backend.
+func (writer *Writer) flush() error {
+	if writer.failure != nil {
+		return writer.failure
+	}
+
+	var size = writer.flushableEnd()
+
+	if size == 0 {
+		return nil
+	}
+
+	written, err := writer.write(writer.buffer[:size], 0)
+
+	writer.discard(written)
+
+	return err
+}
+
+// Buffered returns amount of bytes, that are buffered and not yet written into
+// backend.
+func (writer *Writer) Buffered() int {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return len(writer.buffer)
+}
+
+// MaxBuffered returns the largest amount of bytes, that was ever buffered
+// during Writer lifetime, including data of incomplete lines and complete
+// lines waiting to be written into backend. It's not affected by buffer
+// shrinking and Reset.
+func (writer *Writer) MaxBuffered() int {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.peak
+}
+
+// Closed returns true if Writer is closed by Close or Detach.
+func (writer *Writer) Closed() bool {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.closed
+}
+
+// Peek returns copy of data, that is buffered and not yet written into
+// backend. Returned slice is a snapshot, which is not changed by subsequent
+// writes and can be modified by caller.
+func (writer *Writer) Peek() []byte {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return append([]byte(nil), writer.buffer...)
+}
+
+// WriteTo writes copy of data, that is buffered and not yet written into
+// backend, into given writer, keeping data in the buffer, e.g. for crash
+// dumps. Data is copied under Writer mutex, so it's not torn by concurrent
+// writes, while given writer is called without holding any locks.
+//
+// Signature matches with io.WriterTo's WriteTo().
+func (writer *Writer) WriteTo(target io.Writer) (int64, error) {
+	data := writer.Peek()
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	written, err := target.Write(data)
+	if err == nil && written < len(data) {
+		err = io.ErrShortWrite
+	}
+
+	return int64(written), err
+}
+
+// Stats returns total amount of complete lines and bytes written into backend.
+// Stats doesn't take Writer mutex, so it doesn't wait for concurrent writes,
+// counters of which can be partially applied.
+func (writer *Writer) Stats() (lines uint64, bytes uint64) {
+	return writer.lines.Load(), writer.bytes.Load()
+}
+
+// Fd returns file descriptor of backend if it implements Fd() method, like
+// *os.File does, so terminal detection can see through Writer. Otherwise
+// ^uintptr(0) is returned, which is never a valid descriptor.
+func (writer *Writer) Fd() uintptr {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if file, ok := writer.backend.(interface{ Fd() uintptr }); ok {
+		return file.Fd()
+	}
+
+	return ^uintptr(0)
+}
+
+// SetWriteDeadline sets deadline, that is set to backend before every write
+// into it, if backend implements SetWriteDeadline() method, like net.Conn
+// does, so write, that blocks past deadline, fails with timeout error of
+// backend. Zero value means no deadline.
+//
+// If backend doesn't support deadlines, os.ErrNoDeadline is returned and
+// writes into backend are not limited in time.
+func (writer *Writer) SetWriteDeadline(deadline time.Time) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.deadline = deadline
+	writer.hasDeadline = true
+
+	if _, ok := writer.backend.(deadliner); !ok {
+		return os.ErrNoDeadline
+	}
+
+	return nil
+}
+
+// deadliner is implemented by backends, that support write deadlines.
+type deadliner interface {
+	SetWriteDeadline(deadline time.Time) error
+}
+
+// Config describes Writer configuration.
+type Config struct {
+	// Delimiter is byte sequence, that terminates line.
+	Delimiter []byte
+
+	// EnsureNewline is true if Close terminates last line with delimiter.
+	EnsureNewline bool
+
+	// Prefix is prepended to every line.
+	Prefix string
+
+	// MaxBufferBytes is size of incomplete line, that is written as soon as
+	// it's reached, or zero.
+	MaxBufferBytes int
+
+	// MaxLineBytes is size of line, that is cut as soon as it's exceeded, or
+	// zero.
+	MaxLineBytes int
+}
+
+// Config returns copy of Writer configuration.
+func (writer *Writer) Config() Config {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.config()
+}
+
+// config returns copy of Writer configuration.
+func (writer *Writer) config() Config {
+	return Config{
+		Delimiter:      append([]byte(nil), writer.terminator...),
+		EnsureNewline:  writer.ensureNewline,
+		Prefix:         string(writer.prefix),
+		MaxBufferBytes: writer.maxBuffer,
+		MaxLineBytes:   writer.maxLine,
+	}
+}
+
+// Options describes effective Writer configuration, including optional
+// behavior specified by options, see corresponding With* functions. Functions
+// and writers specified by options are not included.
+type Options struct {
+	Config
+
+	// EnsureNewlineAlways is specified by WithEnsureNewlineAlways.
+	EnsureNewlineAlways bool
+
+	// SoftDelimiter is specified by WithSoftFlushDelimiter.
+	SoftDelimiter []byte
+
+	// Header is specified by WithHeader.
+	Header []byte
+
+	// Trailer is specified by WithTrailer.
+	Trailer []byte
+
+	// EmptyMarker is specified by WithEmptyMarker.
+	EmptyMarker []byte
+
+	// Timestamp is time format specified by WithTimestamp.
+	Timestamp string
+
+	// StripDelimiter is specified by WithStripDelimiter.
+	StripDelimiter bool
+
+	// CarriageReturnAsLine and KeepCarriageReturn are specified by
+	// WithCarriageReturnAsLine.
+	CarriageReturnAsLine bool
+	KeepCarriageReturn   bool
+
+	// NormalizeNewlines is specified by WithNormalizeNewlines.
+	NormalizeNewlines bool
+
+	// LineNumbers is specified by WithLineNumbers.
+	LineNumbers bool
+
+	// CollapseBlankLines is specified by WithCollapseBlankLines.
+	CollapseBlankLines bool
+
+	// DedupConsecutive and DedupSummary are specified by
+	// WithDedupConsecutive.
+	DedupConsecutive bool
+	DedupSummary     bool
+
+	// TrimTrailingSpace is specified by WithTrimTrailingSpace.
+	TrimTrailingSpace bool
+
+	// StripANSI is specified by WithStripANSI.
+	StripANSI bool
+
+	// SanitizeControlChars is specified by WithSanitizeControlChars.
+	SanitizeControlChars bool
+
+	// ValidUTF8 and UTF8Replacement are specified by WithValidUTF8.
+	ValidUTF8       bool
+	UTF8Replacement rune
+
+	// JSONLineMode is specified by WithJSONLineMode.
+	JSONLineMode bool
+
+	// DiscardPartialOnClose is specified by WithDiscardPartialOnClose.
+	DiscardPartialOnClose bool
+
+	// ForceLinePerWrite is specified by WithForceLinePerWrite.
+	ForceLinePerWrite bool
+
+	// MaxTotalBytes is specified by WithMaxTotalBytes.
+	MaxTotalBytes int64
+
+	// SizeOrLineFlush is specified by WithSizeOrLineFlush.
+	SizeOrLineFlush int
+
+	// BatchBytes is specified by WithBatchBytes.
+	BatchBytes int
+
+	// ShrinkThreshold is specified by WithShrinkThreshold.
+	ShrinkThreshold int
+
+	// RateLimit and RateLimitMode are specified by WithRateLimit.
+	RateLimit     int
+	RateLimitMode RateLimitMode
+
+	// DropOldest is specified by WithDropOldest.
+	DropOldest int
+
+	// QueueFullPolicy is specified by WithQueueFullPolicy.
+	QueueFullPolicy QueueFullPolicy
+
+	// RetainOnError is specified by WithRetainOnError.
+	RetainOnError bool
+
+	// StickyError is specified by WithStickyError.
+	StickyError bool
+
+	// WithoutBackendClose is specified by WithoutBackendClose.
+	WithoutBackendClose bool
+
+	// Unsynchronized is specified by WithUnsynchronized.
+	Unsynchronized bool
+}
+
+// Options returns copy of effective Writer configuration, so it can be
+// logged or inspected at once.
+func (writer *Writer) Options() Options {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	options := Options{
+		Config:                writer.config(),
+		EnsureNewlineAlways:   writer.ensureAlways,
+		SoftDelimiter:         append([]byte(nil), writer.soft...),
+		Header:                append([]byte(nil), writer.header...),
+		Trailer:               append([]byte(nil), writer.trailer...),
+		EmptyMarker:           append([]byte(nil), writer.marker...),
+		Timestamp:             writer.timestamp,
+		StripDelimiter:        writer.strip,
+		CarriageReturnAsLine:  writer.carriage,
+		KeepCarriageReturn:    writer.keepCarriage,
+		NormalizeNewlines:     writer.normalize,
+		LineNumbers:           writer.numbering,
+		CollapseBlankLines:    writer.collapse,
+		DedupConsecutive:      writer.dedup,
+		DedupSummary:          writer.summary,
+		TrimTrailingSpace:     writer.trimSpace,
+		StripANSI:             writer.stripANSI,
+		SanitizeControlChars:  writer.sanitize,
+		JSONLineMode:          writer.jsonLines,
+		DiscardPartialOnClose: writer.discardPartial,
+		ForceLinePerWrite:     writer.forceLine,
+		MaxTotalBytes:         writer.maxTotal,
+		SizeOrLineFlush:       writer.chunkSize,
+		BatchBytes:            writer.batch,
+		ShrinkThreshold:       writer.shrink,
+		DropOldest:            writer.maxQueued,
+		QueueFullPolicy:       writer.queuePolicy,
+		RetainOnError:         writer.retain,
+		StickyError:           writer.sticky,
+		WithoutBackendClose:   writer.keepBackend,
+	}
+
+	if writer.replacement != nil {
+		options.ValidUTF8 = true
+		options.UTF8Replacement, _ = utf8.DecodeRune(writer.replacement)
+	}
+
+	if writer.limiter != nil {
+		options.RateLimit = writer.limiter.rate
+		options.RateLimitMode = writer.limiter.mode
+	}
+
+	_, options.Unsynchronized = writer.mutex.(nopLocker)
+
+	return options
+}
+
+// Delimiter returns rune, that terminates line. If delimiter is byte sequence
+// specified by WithDelimiterBytes, utf8.RuneError is returned, see Config.
+func (writer *Writer) Delimiter() rune {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if len(writer.delimiters) > 0 {
+		return utf8.RuneError
+	}
+
+	return writer.newline
+}
+
+// SetDelimiter makes Writer to treat `delimiter` as line terminator for
+// data, that is written after the call, like WithDelimiter does. All
+// complete lines, that are buffered, are written into backend before
+// delimiter is changed, so they are terminated by previous delimiter, while
+// buffered incomplete line is continued and terminated by new one.
+//
+// If buffered incomplete line already contains new delimiter, it's not known
+// whether it terminates line or not, so delimiter is not changed and
+// ErrAmbiguousDelimiter is returned.
+func (writer *Writer) SetDelimiter(delimiter rune) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrClosed
+	}
+
+	err := writer.drain()
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(writer.buffer, utf8.AppendRune(nil, delimiter)) {
+		return ErrAmbiguousDelimiter
+	}
+
+	writer.newline = delimiter
+	writer.delimiters = nil
+	writer.terminator = writer.delimiter()
+
+	// Buffered data is searched again for new delimiter.
+	writer.scanned = 0
+	writer.ended = 0
+	writer.scannedRecord = writer.record
+
+	return nil
+}
+
+// EnsuresNewline returns true if Close terminates last line with delimiter.
+func (writer *Writer) EnsuresNewline() bool {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.ensureNewline
+}
+
+// String returns description of Writer state and configuration. Buffered data
+// itself is not included.
+//
+// Signature matches with fmt.Stringer's String().
+func (writer *Writer) String() string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return fmt.Sprintf(
+		"lineflushwriter{buffered: %d bytes, closed: %t, delimiter: %q, "+
+			"ensure newline: %t}",
+		len(writer.buffer),
+		writer.closed,
+		writer.terminator,
+		writer.ensureNewline,
+	)
+}
+
+// Detach closes Writer without writing buffered data and without closing
+// backend and returns buffered data, so it can be recovered from Writer,
+// that can't be closed. Hook specified by WithCloseHook is not called.
+//
+// Detach is safe to call concurrently with other methods: data of every write
+// call, that completed before Detach, is either written into backend or
+// returned, while subsequent writes return ErrClosed. Returned slice is not
+// used by Writer anymore. Detach of closed writer returns nil.
+func (writer *Writer) Detach() []byte {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return nil
+	}
+
+	return writer.detach()
+}
+
+// Abort closes Writer and backend without writing buffered data, e.g. when
+// output is not needed anymore, so huge incomplete line is not written into
+// backend, that is going to be discarded. Buffered data is dropped. Hook
+// specified by WithCloseHook is not called.
+//
+// Returned error wraps ErrCloseBackend. Abort of closed writer does nothing
+// and returns nil.
+func (writer *Writer) Abort() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return nil
+	}
+
+	writer.detach()
+
+	if err := writer.closeBackend(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCloseBackend, err)
+	}
+
+	return nil
+}
+
+// detach closes Writer without writing buffered data and returns it.
+func (writer *Writer) detach() []byte {
+	writer.closed = true
+
+	for _, stop := range writer.stops {
+		stop()
+	}
+
+	writer.stops = nil
+
+	writer.endGroup()
+
+	data := writer.buffer
+
+	writer.buffer = nil
+	writer.scanned = 0
+	writer.ended = 0
+	writer.record = jsonState{}
+	writer.scannedRecord = jsonState{}
+
+	return data
+}
+
+// Reset discards all buffered data without writing it and makes Writer to
+// write into given backend, keeping configuration. Closed writer becomes open
+// again.
+func (writer *Writer) Reset(backend io.WriteCloser) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.backend = backend
+	writer.failure = nil
+	writer.headed = false
+	writer.dirty = false
+	writer.truncate(0)
+	writer.record = jsonState{}
+	writer.scannedRecord = jsonState{}
+	writer.midline = false
+	writer.rewound = false
+	writer.blank = false
+	writer.last = writer.last[:0]
+	writer.repeats = 0
+	writer.dropping = false
+	writer.column = 0
+	writer.closed = false
+}
+
+// SwapBackend writes all buffered complete lines into current backend, makes
+// Writer to write into given backend and returns previous one, so it can be
+// closed by caller, e.g. on log rotation. Incomplete line is kept in the
+// buffer and will be written into new backend. If previous backend does not
+// implement io.Closer, nil is returned instead of it.
+//
+// If complete lines were not written, backend is not swapped and error is
+// returned.
+func (writer *Writer) SwapBackend(
+	backend io.WriteCloser,
+) (io.WriteCloser, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return nil, ErrClosed
+	}
+
+	// Lines can't be written into failed backend, so they are written into
+	// new one.
+	if writer.failure == nil {
+		err := writer.drain()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	old, _ := writer.backend.(io.WriteCloser)
+
+	// Line, that was started in previous backend, starts anew in new one,
+	// which gets its own header.
+	writer.backend = backend
+	writer.failure = nil
+	writer.headed = false
+	writer.dirty = false
+	writer.midline = false
+	writer.rewound = false
+	writer.column = 0
+
+	return old, nil
+}
+
+// SetLock makes Writer to use given lock, that is shared between writers,
+// instead of current one, keeping buffered data, e.g. to move writer from own
+// lock to lock of other writers without reconstructing it. New lock is
+// installed while current lock is held, so it never happens in the middle of
+// backend write. Fresh mutex is used if lock is nil.
+//
+// Other writers, that share current lock, keep using it, so all of them must
+// be quiesced or switched while lock is replaced, otherwise their writes can
+// be interleaved with writes of this Writer. Group started by BeginGroup is
+// ended. Line guard, if any, is replaced by given lock if it's LineGuard.
+func (writer *Writer) SetLock(lock sync.Locker) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.endGroup()
+
+	if lock == nil {
+		lock = &sync.Mutex{}
+	}
+
+	current := writer.lock
+
+	current.Lock()
+	defer current.Unlock()
+
+	writer.guard, _ = lock.(*LineGuard)
+	writer.lock = lock
+}
+
+// Close flushes all remaining data and closes underlying backend writer.
+// If `ensureNewLine` was specified and remaining data does not ends with
+// line delimiter, then delimiter will be added. Delimiter is added even if
+// incomplete line was already written into backend, e.g. by Flush.
+//
+// If WithDiscardPartialOnClose was specified, incomplete line is discarded
+// instead and `ensureNewline` has no effect.
+//
+// Backend is closed even if remaining data was not written. Returned error
+// wraps ErrFlush and/or ErrCloseBackend, so it's possible to distinguish,
+// whether data was lost or not.
+//
+// Hook specified by WithCloseHook is called after backend is closed.
+// Backend is not closed if WithoutBackendClose was specified.
+//
+// Only first call of Close has effect, subsequent calls return nil without
+// touching backend.
+//
+// Signature matches with io.WriteCloser's Close().
+func (writer *Writer) Close() error {
+	_, err := writer.CloseWithReport()
+
+	return err
+}
+
+// CloseWithReport works like Close, but also returns amount of buffered
+// bytes, that were written into backend on close, including delimiter added
+// due to `ensureNewline`, so amount of lost data is known if remaining data
+// was written only partially. Subsequent calls return zero and nil.
+func (writer *Writer) CloseWithReport() (flushed int, err error) {
+	flushed, hook, err := writer.closeOnce()
+	if hook != nil {
+		hook(flushed, err)
+	}
+
+	return flushed, err
+}
+
+// closeOnce closes writer unless it's already closed and returns close hook,
+// that should be called after mutex is released.
+func (writer *Writer) closeOnce() (int, func(int, error), error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return 0, nil, nil
+	}
+
+	flushed, err := writer.close()
+
+	return flushed, writer.closeHook, err
+}
+
+// close flushes remaining data, closes backend and returns amount of flushed
+// bytes.
+func (writer *Writer) close() (int, error) {
+	writer.closed = true
+
+	for _, stop := range writer.stops {
+		stop()
+	}
+
+	writer.stops = nil
+
+	var errs []error
+
+	flushed, err := writer.flushRemaining()
+	if err == nil {
+		err = writer.writeMarker()
+	}
+
+	if err == nil {
+		err = writer.writeTrailer()
+	}
+
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrFlush, err))
+	}
+
+	if err := writer.closeBackend(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrCloseBackend, err))
+	}
+
+	writer.endGroup()
+
+	return flushed, errors.Join(errs...)
+}
+
+// flushRemaining writes all remaining data into backend on close and returns
+// amount of written bytes.
+func (writer *Writer) flushRemaining() (int, error) {
+	if writer.failure != nil {
+		return 0, writer.failure
+	}
+
+	writer.syncLine()
+
+	if end := writer.lastLineEnd(); writer.partialHook != nil &&
+		end < len(writer.buffer) {
+		writer.partialHook(append([]byte(nil), writer.buffer[end:]...))
+	}
+
+	if writer.discardPartial {
+		writer.truncate(writer.lastLineEnd())
+	}
+
+	if writer.ensureAlways {
+		writer.trimBlankLines()
+	}
+
+	// Incomplete line can be already written into backend completely, e.g.
+	// due to max buffer size, so only delimiter is written.
+	if writer.ensureNewline &&
+		(len(writer.buffer) > 0 || writer.midline && !writer.discardPartial) {
+		writer.terminated = writer.terminate()
+	}
+
+	// Summary of repeated lines is written even if buffer is empty.
+	if len(writer.buffer) == 0 && (writer.repeats == 0 || !writer.summary) {
+		return 0, nil
+	}
+
+	written, err := writer.write(writer.buffer, 0)
+
+	writer.discard(written)
+	writer.terminated = false
+
+	return written, err
+}
+
+// terminate appends delimiter to the buffer unless it already ends with
+// delimiter and returns true if delimiter was appended.
+func (writer *Writer) terminate() bool {
+	delimiter := writer.terminator
+
+	if bytes.HasSuffix(writer.buffer, delimiter) {
+		return false
+	}
+
+	// Incomplete delimiter at the end of buffer is just completed.
+	partial := writer.partialDelimiter()
+
+	writer.buffer = append(writer.buffer, delimiter[partial:]...)
+
+	return true
+}
+
+// trimTrailingSpace returns given line without spaces and tabs at the end of
+// line, keeping its delimiter. Line is returned as is if it has no trailing
+// spaces.
+func trimTrailingSpace(line []byte, delimiter []byte) []byte {
+	var (
+		body    = bytes.TrimSuffix(line, delimiter)
+		trimmed = bytes.TrimRight(body, " \t")
+	)
+
+	if len(trimmed) == len(body) {
+		return line
+	}
+
+	return append(trimmed[:len(trimmed):len(trimmed)], line[len(body):]...)
+}
+
+// trailingBlankLines returns position in the buffer, after which only blank
+// lines follow. Delimiter at the beginning of the buffer is blank line only if
+// there is no incomplete line in backend.
+func (writer *Writer) trailingBlankLines() int {
+	var (
+		data      = writer.buffer
+		delimiter = writer.terminator
+		end       = len(data)
+	)
+
+	for bytes.HasSuffix(data[:end], delimiter) {
+		start := end - len(delimiter)
+
+		if !bytes.HasSuffix(data[:start], delimiter) &&
+			(start > 0 || writer.midline) {
+			break
+		}
+
+		end = start
+	}
+
+	return end
+}
+
+// trimBlankLines removes trailing blank lines from the buffer. If output
+// consists of blank lines only, single delimiter is kept. Incomplete line,
+// that was written into backend, is terminated with delimiter instead.
+func (writer *Writer) trimBlankLines() {
+	end := writer.trailingBlankLines()
+
+	if end == 0 && len(writer.buffer) > 0 && !writer.dirty {
+		end = len(writer.terminator)
+	}
+
+	writer.truncate(end)
+
+	if len(writer.buffer) == 0 && writer.midline {
+		writer.buffer = append(writer.buffer, writer.terminator...)
+	}
+}
+
+// terminatePartial appends delimiter to the buffer if incomplete line is
+// buffered or was written into backend.
+func (writer *Writer) terminatePartial() {
+	writer.syncLine()
+
+	if len(writer.buffer) > writer.lastLineEnd() {
+		writer.terminate()
+	}
+
+	if len(writer.buffer) == 0 && writer.midline {
+		writer.buffer = append(writer.buffer, writer.terminator...)
+	}
+}
+
+// writeTrailer writes trailer specified by WithTrailer into backend if
+// anything was written into it.
+func (writer *Writer) writeTrailer() error {
+	if len(writer.trailer) == 0 || !writer.dirty {
+		return nil
+	}
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	written, err := writer.writeBackend(writer.trailer)
+
+	writer.bytes.Add(uint64(written))
+
+	return err
+}
+
+// writeMarker writes empty marker into backend on close, if nothing was
+// written into backend, along with preamble and header.
+func (writer *Writer) writeMarker() error {
+	if len(writer.marker) == 0 || writer.dirty {
+		return nil
+	}
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	err := writer.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	written, err := writer.writeBackend(writer.marker)
+
+	writer.bytes.Add(uint64(written))
+
+	return err
+}
+
+// closeBackend closes backend if it implements io.Closer, unless
+// WithoutBackendClose was specified.
+func (writer *Writer) closeBackend() error {
+	// Queue of writer returned by NewAsync is drained anyway, while backend
+	// behind the queue is kept by asyncBackend itself.
+	_, async := writer.backend.(*asyncBackend)
+	if writer.keepBackend && !async {
+		return nil
+	}
+
+	if closer, ok := writer.backend.(io.Closer); ok {
+		writer.lock.Lock()
+		defer writer.lock.Unlock()
+
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// flushLines writes complete lines from the buffer into backend, where first
+// `pending` bytes of buffer were buffered before current write call. Returns
+// amount of bytes written from current write call.
+func (writer *Writer) flushLines(pending int) (int, error) {
+	var (
+		size     = len(writer.buffer) - pending
+		last     = writer.lastLineEnd()
+		complete = last
+	)
+
+	writer.peak = max(writer.peak, len(writer.buffer))
+
+	if writer.maxLine > 0 {
+		var (
+			column = writer.column
+			end    = writer.flushableEnd()
+		)
+
+		if last > 0 {
+			column = 0
+		}
+
+		// Carriage return at the end of the buffer can be terminator, so
+		// it's not the part of line.
+		if writer.carriage && end > last &&
+			writer.buffer[end-1] == carriageReturn {
+			end--
+		}
+
+		partial := max(end-last, 0)
+
+		// At least one byte is kept buffered after the cut, so line, which
+		// size is equal to max line size, is not cut if it's terminated by
+		// the next write.
+		if column+partial > writer.maxLine {
+			last += (column+partial-1)/writer.maxLine*writer.maxLine - column
+		}
+	}
+
+	if writer.maxBuffer > 0 && len(writer.buffer)-last >= writer.maxBuffer {
+		last = writer.flushableEnd()
+	}
+
+	if writer.chunkSize > 0 && len(writer.buffer)-last >= writer.chunkSize {
+		last = writer.flushableEnd()
+	}
+
+	// Trailing blank lines are kept in the buffer, so they are dropped on
+	// close if nothing follows them.
+	if writer.ensureAlways && last == len(writer.buffer) {
+		last = writer.trailingBlankLines()
+		complete = last
+	}
+
+	// Complete lines are kept in the buffer until batch is large enough,
+	// unless data is forcibly written due to max line or buffer size.
+	if writer.batch > 0 && last == complete && last < writer.batch {
+		last = 0
+	}
+
+	// Only new data is searched for soft delimiter, because buffered data
+	// was already written up to the last soft delimiter in it.
+	if len(writer.soft) > 0 {
+		from := max(last, pending-len(writer.soft)+1, 0)
+
+		end := lastDelimiterEnd(writer.buffer[from:], writer.soft)
+		if end > 0 {
+			last = from + end
+		}
+	}
+
+	if last > 0 {
+		written, err := writer.write(writer.buffer[:last], pending)
+		if err != nil && writer.retain {
+			writer.discard(written)
+			writer.dropOldest()
+
+			return size, err
+		}
+
+		if err != nil {
+			// Only bytes that reached backend are considered consumed from
+			// data, rest of data is dropped from buffer, so caller can retry
+			// them.
+			if written < pending {
+				writer.truncate(pending)
+				writer.discard(written)
+
+				return 0, err
+			}
+
+			writer.truncate(0)
+
+			return written - pending, err
+		}
+
+		writer.discard(last)
+	}
+
+	writer.dropOldest()
+
+	return size, nil
+}
+
+// writeHeader writes preamble specified by WithPreamble and header specified
+// by WithHeader into backend unless they are already written. Lock should be
+// held by caller.
+func (writer *Writer) writeHeader() error {
+	if len(writer.preamble) > 0 {
+		written, err := writer.writeBackend(writer.preamble)
+
+		writer.bytes.Add(uint64(written))
+
+		// Only the rest of preamble is written on retry.
+		writer.preamble = writer.preamble[written:]
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(writer.header) == 0 || writer.headed {
+		return nil
+	}
+
+	written, err := writer.writeBackend(writer.header)
+
+	writer.bytes.Add(uint64(written))
+
+	if err != nil {
+		return err
+	}
+
+	writer.headed = true
+
+	return nil
+}
+
+// writesDirectly returns true if complete lines can be written into backend
+// right from given data without copying them into the buffer first.
+func (writer *Writer) writesDirectly() bool {
+	return !writer.retain &&
+		!writer.ensureAlways &&
+		writer.batch == 0 &&
+		len(writer.soft) == 0 &&
+		!writer.forceLine &&
+		!writer.jsonLines &&
+		!writer.carriage &&
+		writer.maxBuffer == 0 &&
+		writer.chunkSize == 0 &&
+		writer.maxLine == 0
+}
+
+// writeDirectly writes complete lines from given data into backend while the
+// buffer is empty and buffers only remaining incomplete line.
+func (writer *Writer) writeDirectly(data []byte) (int, error) {
+	last := lastDelimiterEnd(data, writer.terminator)
+
+	if last > 0 {
+		written, err := writer.write(data[:last], 0)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	writer.buffer = append(writer.buffer, data[last:]...)
+	writer.peak = max(writer.peak, len(writer.buffer))
+
+	return len(data), nil
+}
+
+// write writes given chunk of buffered data into backend under the lock and
+// returns amount of bytes from chunk that were written. First `pending` bytes
+// of chunk were buffered before current write call, so they are not counted
+// by position of line in backend error.
+func (writer *Writer) write(chunk []byte, pending int) (int, error) {
+	var written int
+
+	for {
+		count, err := writer.writeLocked(chunk[written:])
+
+		written += count
+
+		// Lock is not held while waiting for rate limit, so writers sharing
+		// it are not stalled.
+		if err == errRateLimited {
+			writer.limiter.wait(writer.clock)
+
+			continue
+		}
+
+		if failure, ok := err.(backendError); ok {
+			err = lineError(
+				failure.error,
+				chunk,
+				written,
+				pending,
+				writer.terminator,
+			)
+		}
+
+		// Context error is not backend error, so it's not sticky.
+		if err != nil && writer.sticky &&
+			(writer.ctx == nil || err != writer.ctx.Err()) {
+			writer.failure = err
+		}
+
+		return written, err
+	}
+}
+
+// writeLocked writes given chunk of buffered data into backend while lock is
+// held and returns amount of bytes from chunk that were written.
+func (writer *Writer) writeLocked(chunk []byte) (int, error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	return writer.writeChunks(chunk)
+}
+
+// writeChunks writes given chunk of buffered data into backend by chunks of
+// size specified by WithSizeOrLineFlush, each ending at line boundary if
+// possible, and returns amount of bytes from chunk that were written. Lock
+// should be held by caller.
+func (writer *Writer) writeChunks(chunk []byte) (int, error) {
+	if writer.ctx == nil &&
+		(writer.chunkSize == 0 || len(chunk) <= writer.chunkSize) {
+		return writer.writeChunk(chunk)
+	}
+
+	// Delimiter appended on close belongs to the last chunk only.
+	terminated := writer.terminated
+	defer func() {
+		writer.terminated = terminated
+	}()
+
+	var written int
+
+	for written < len(chunk) {
+		var (
+			rest = chunk[written:]
+			size = len(rest)
+		)
+
+		// Line, that is longer than chunk size, is split.
+		if writer.chunkSize > 0 && size > writer.chunkSize {
+			size = writer.chunkSize
+
+			end := lastDelimiterEnd(rest[:size], writer.terminator)
+			if end > 0 {
+				size = end
+			}
+		}
+
+		// Context of WriteContext is checked before every line.
+		if writer.ctx != nil {
+			if err := writer.ctx.Err(); err != nil {
+				return written, err
+			}
+
+			end := bytes.Index(rest[:size], writer.terminator)
+			if end >= 0 {
+				size = end + len(writer.terminator)
+			}
+		}
+
+		writer.terminated = terminated && size == len(rest)
+
+		count, err := writer.writeChunk(rest[:size])
+
+		written += count
+
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// writeChunk writes given chunk of buffered data into backend and returns
+// amount of bytes from chunk that were written. Lock should be held by
+// caller.
+func (writer *Writer) writeChunk(chunk []byte) (int, error) {
+	err := writer.guardLine()
+	if err != nil {
+		return 0, err
+	}
+
+	if backend, ok := writer.backend.(deadliner); ok && writer.hasDeadline {
+		err := backend.SetWriteDeadline(writer.deadline)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = writer.writeHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	if writer.rewound {
+		_, err := writer.writeBackend([]byte{carriageReturn})
+		if err != nil {
+			return 0, err
+		}
+
+		writer.rewound = false
+	}
+
+	written, err := writer.writeLines(chunk)
+
+	writer.trackLine()
+
+	return written, err
+}
+
+// writeLines writes given chunk of buffered data into backend, processing
+// every line with configured line function and prefix, and returns amount of
+// bytes from chunk that were written.
+func (writer *Writer) writeLines(chunk []byte) (int, error) {
+	var delimiter = writer.terminator
+
+	if !writer.processesLines() {
+		written, err := writer.writeBackend(chunk)
+
+		writer.lines.Add(uint64(bytes.Count(chunk[:written], delimiter)))
+		writer.bytes.Add(uint64(written))
+
+		if writer.observer != nil {
+			for _, line := range splitLines(nil, chunk[:written], delimiter) {
+				if bytes.HasSuffix(line, delimiter) {
+					writer.observer(len(line))
+				}
+			}
+		}
+
+		if written > 0 {
+			writer.midline = !bytes.HasSuffix(chunk[:written], delimiter)
+		}
+
+		if err != nil {
+			return written, backendError{err}
+		}
+
+		return written, nil
+	}
+
+	var (
+		pieces   = writer.splitPieces(writer.pieces[:0], chunk)
+		spans    = writer.spans[:0]
+		output   = writer.scratch[:0]
+		midline  = writer.midline
+		blank    = writer.blank
+		dropping = writer.dropping
+		number   = writer.number
+		last     = writer.last
+		repeats  = writer.repeats
+		waiting  = false
+	)
+
+	for i, piece := range pieces {
+		// Lines, that were accepted before waiting for rate limit, are
+		// written first, while the rest is written by write after waiting.
+		if writer.limiter != nil && writer.limiter.mode == RateLimitBlock &&
+			!midline && writer.limiter.exhausted(writer.clock()) {
+			pieces = pieces[:i]
+			waiting = true
+
+			break
+		}
+
+		line := piece.data
+		if piece.cut {
+			line = append(line[:len(line):len(line)], delimiter...)
+		}
+
+		data := line
+		if writer.normalize && piece.complete {
+			body := bytes.TrimSuffix(data, delimiter)
+			body = bytes.TrimSuffix(body, []byte{carriageReturn})
+			data = append(body[:len(body):len(body)], delimiter...)
+		}
+
+		// Line, that is written on close, is not continued anymore.
+		if writer.trimSpace &&
+			(piece.complete || piece.cut || writer.closed) {
+			data = trimTrailingSpace(data, delimiter)
+		}
+
+		if writer.strip && !(writer.terminated && i == len(pieces)-1) {
+			data = bytes.TrimSuffix(data, delimiter)
+		}
+
+		if piece.complete && !writer.keepCarriage &&
+			!bytes.HasSuffix(data, delimiter) {
+			data = bytes.TrimSuffix(data, []byte{carriageReturn})
+		}
+
+		data = writer.transform(data)
+
+		// Only blank line, that follows another blank line, is dropped.
+		if writer.collapse && len(data) > 0 {
+			if !midline && bytes.Equal(data, delimiter) {
+				if blank {
+					data = nil
+				}
+
+				blank = true
+			} else {
+				blank = false
+			}
+		}
+
+		// Repeated line is dropped, while any other line, that starts in
+		// the output, ends the run of repeated lines.
+		if writer.dedup && len(data) > 0 && !midline {
+			if piece.complete && bytes.Equal(data, last) {
+				repeats++
+				data = nil
+			} else {
+				output, number = writer.appendRepeated(output, repeats, number)
+				repeats = 0
+				last = nil
+
+				if piece.complete {
+					last = data
+				}
+			}
+		}
+
+		if writer.limiter != nil && len(data) > 0 {
+			if !midline {
+				dropping = !writer.limiter.take(writer.clock())
+				if dropping {
+					writer.dropped++
+				}
+			}
+
+			if dropping {
+				data = nil
+			}
+		}
+
+		span := span{head: len(output)}
+
+		if len(data) > 0 && !midline {
+			output = writer.appendHeader(output, number)
+
+			if writer.numbering {
+				number++
+			}
+		}
+
+		span.start = len(output)
+		span.number = number
+		output = append(output, data...)
+		span.end = len(output)
+
+		if writer.router != nil && len(data) > 0 &&
+			(piece.cut || piece.complete) {
+			span.route = writer.router(data)
+		}
+
+		spans = append(spans, span)
+
+		midline = !piece.cut && !piece.complete
+	}
+
+	if writer.closed && !waiting {
+		output, number = writer.appendRepeated(output, repeats, number)
+		repeats = 0
+	}
+
+	written, err := writer.writeBackend(output)
+
+	writer.keepScratch(pieces, spans, output)
+
+	writer.bytes.Add(uint64(written))
+
+	consumed := 0
+
+	for i, piece := range pieces {
+		span := spans[i]
+
+		if written >= span.start {
+			writer.number = span.number
+		}
+
+		switch {
+		case written >= span.end:
+			consumed += len(piece.data)
+
+			writer.column = piece.column
+
+			if span.end > span.start &&
+				(piece.cut || piece.complete) {
+				writer.lines.Add(1)
+
+				if writer.observer != nil {
+					writer.observer(span.end - span.head)
+				}
+
+				// Errors of additional destination are ignored, like
+				// errors of tee writer.
+				if span.route != nil {
+					span.route.Write(output[span.head:span.end])
+				}
+			}
+
+		// Partially written line can be mapped back to chunk only if it
+		// was not transformed.
+		case written > span.start && !writer.transformsLines():
+			consumed += min(written-span.start, len(piece.data))
+		}
+	}
+
+	clear(pieces)
+	clear(spans)
+
+	if err != nil {
+		if consumed > 0 {
+			writer.midline = !bytes.HasSuffix(chunk[:consumed], delimiter)
+		}
+
+		// It's not known which blank or repeated line was written, so next
+		// one is written anyway.
+		writer.blank = false
+		writer.last = writer.last[:0]
+		writer.repeats = 0
+
+		return consumed, backendError{err}
+	}
+
+	writer.midline = midline
+	writer.blank = blank
+	writer.dropping = dropping
+	writer.last = append(writer.last[:0], last...)
+	writer.repeats = repeats
+
+	if waiting {
+		return consumed, errRateLimited
+	}
+
+	return len(chunk), nil
+}
+
+// backendError marks error of backend returned by writeLines, so it's wrapped
+// by write with position of line, which was not written.
+type backendError struct {
+	error
+}
+
+// lineError wraps given error of backend with number of line, counting from
+// 1, which was not written completely, and with offset of first byte, that
+// was not written, both within chunk without first `pending` bytes, that
+// were buffered before current write call.
+func lineError(
+	err error,
+	chunk []byte,
+	written int,
+	pending int,
+	delimiter []byte,
+) error {
+	var (
+		data   = chunk[min(pending, len(chunk)):]
+		offset = max(written-pending, 0)
+		line   = bytes.Count(data[:offset], delimiter) + 1
+	)
+
+	return fmt.Errorf("flush line %d (offset %d): %w", line, offset, err)
+}
+
+// keepScratch keeps memory of given slices, that were used by writeLines, so
+// it's reused by the next call. Output, that is larger than shrink threshold,
+// is not kept.
+func (writer *Writer) keepScratch(pieces []piece, spans []span, output []byte) {
+	writer.pieces = pieces[:0]
+	writer.spans = spans[:0]
+
+	if writer.shrink == 0 || cap(output) <= writer.shrink {
+		writer.scratch = output[:0]
+	}
+}
+
+// processesLines returns true if lines should be processed before writing
+// into backend.
+func (writer *Writer) processesLines() bool {
+	return len(writer.prefix) > 0 ||
+		writer.timestamp != "" ||
+		writer.dedup ||
+		writer.router != nil ||
+		writer.transformsLines() ||
+		writer.maxLine > 0 ||
+		writer.numbering ||
+		writer.jsonLines ||
+		writer.carriage ||
+		writer.collapse ||
+		writer.limiter != nil
+}
+
+// transformsLines returns true if lines contents can be changed before
+// writing into backend.
+func (writer *Writer) transformsLines() bool {
+	return writer.lineFunc != nil ||
+		writer.stripANSI ||
+		writer.sanitize ||
+		writer.trimSpace ||
+		writer.replacement != nil ||
+		writer.strip ||
+		writer.carriage && !writer.keepCarriage
+}
+
+// transform applies configured transformations to given line.
+func (writer *Writer) transform(line []byte) []byte {
+	if writer.stripANSI {
+		line = stripEscapes(line)
+	}
+
+	if writer.lineFunc != nil {
+		line = writer.lineFunc(line)
+	}
+
+	if writer.sanitize {
+		// Escaped representation is longer, so line is changed only if
+		// length of the body is changed.
+		body := writer.lineBody(line)
+		if sanitized := sanitizeControls(body); len(sanitized) != len(body) {
+			line = append(sanitized, line[len(body):]...)
+		}
+	}
+
+	if writer.replacement != nil {
+		body := writer.lineBody(line)
+		if !utf8.Valid(body) {
+			valid := bytes.ToValidUTF8(body, writer.replacement)
+			line = append(valid, line[len(body):]...)
+		}
+	}
+
+	return line
+}
+
+// appendHeader appends timestamp, configured prefix and line number, that
+// should precede every line, to given output.
+func (writer *Writer) appendHeader(output []byte, number int) []byte {
+	if writer.timestamp != "" {
+		output = writer.clock().AppendFormat(output, writer.timestamp)
+		output = append(output, ' ')
+	}
+
+	output = append(output, writer.prefix...)
+
+	if writer.numbering {
+		writer.numberWidth = max(
+			writer.numberWidth,
+			lineNumberWidth,
+			numberWidth(number),
+		)
+
+		output = fmt.Appendf(output, "%*d: ", writer.numberWidth, number)
+	}
+
+	return output
+}
+
+// numberWidth returns amount of characters, that given number takes when
+// formatted in decimal, including sign.
+func numberWidth(number int) int {
+	width := 1
+	if number < 0 {
+		width++
+	}
+
+	for number /= 10; number != 0; number /= 10 {
+		width++
+	}
+
+	return width
+}
+
+// span describes position of piece in output, that is written into backend,
+// and line number after piece.
+type span struct {
+	// head is the position of prefix and other data, that precedes line.
+	head int
+
+	// start and end are the positions of line data.
+	start int
+	end   int
+
+	number int
+
+	// route is the additional destination of line returned by router.
+	route io.Writer
+}
+
+// piece is a part of buffered data, that is written into backend as a
+// separate line or its part.
+type piece struct {
+	data []byte
+
+	// cut is true if piece is the part of line, that exceeded max line size,
+	// and should be terminated with delimiter.
+	cut bool
+
+	// complete is true if piece is the end of line, that includes its
+	// terminator.
+	complete bool
+
+	// column is the length of incomplete line in backend after piece is
+	// written.
+	column int
+}
+
+// splitPieces splits given data into lines, cutting lines, that exceed max
+// line size, into several pieces, and appends them to given pieces.
+func (writer *Writer) splitPieces(pieces []piece, data []byte) []piece {
+	var (
+		column = writer.column
+		limit  = writer.maxLine
+	)
+
+	writer.split = writer.splitLines(writer.split[:0], data)
+
+	for _, line := range writer.split {
+		body := writer.lineBody(line)
+		complete := len(body) < len(line)
+
+		// Incomplete line, that reached max line size, is not cut, because
+		// it's not known yet, whether it will be continued, so it's cut
+		// only when next byte of line is written.
+		for limit > 0 && len(body) > 0 && column+len(body) > limit {
+			size := max(limit-column, 0)
+
+			pieces = append(pieces, piece{data: body[:size], cut: true})
+
+			column = 0
+			body = body[size:]
+			line = line[size:]
+		}
+
+		if complete {
+			column = 0
+		} else {
+			column += len(line)
+		}
+
+		if len(line) > 0 {
+			pieces = append(pieces, piece{
+				data:     line,
+				complete: complete,
+				column:   column,
+			})
+		}
+	}
+
+	clear(writer.split)
+
+	return pieces
+}
+
+// lineBody returns given line, that is produced by splitLines, without its
+// terminator. Line can end with carriage return, that is not followed by
+// anything, only if it's written by Flush or Close, so it's considered
+// terminator too.
+func (writer *Writer) lineBody(line []byte) []byte {
+	if bytes.HasSuffix(line, writer.terminator) {
+		return line[:len(line)-len(writer.terminator)]
+	}
+
+	if writer.carriage && bytes.HasSuffix(line, []byte{carriageReturn}) {
+		return line[:len(line)-1]
+	}
+
+	return line
+}
+
+// writeBackend writes data into backend and guarantees, that returned count of
+// written bytes is not out of data bounds and that error is returned if not all
+// data was written. Lock should be held by caller.
+func (writer *Writer) writeBackend(data []byte) (int, error) {
+	var truncated bool
+
+	if writer.maxTotal > 0 {
+		if writer.exceeded() {
+			return 0, ErrOutputLimitExceeded
+		}
+
+		remaining := writer.maxTotal - int64(writer.bytes.Load())
+		if int64(len(data)) > remaining {
+			data = data[:remaining]
+			truncated = true
+		}
+	}
+
+	var start time.Time
+	if writer.timingHook != nil {
+		start = time.Now()
+	}
+
+	written, err := writer.backend.Write(data)
+	if written < 0 || written > len(data) {
+		return 0, errInvalidWrite
+	}
+
+	if writer.timingHook != nil {
+		writer.timingHook(time.Since(start), written)
+	}
+
+	if err == nil && written < len(data) {
+		err = io.ErrShortWrite
+	}
+
+	if err == nil && truncated {
+		err = ErrOutputLimitExceeded
+	}
+
+	if written > 0 {
+		writer.dirty = true
+	}
+
+	if writer.tee != nil && written > 0 {
+		_, teeErr := writer.tee.Write(data[:written])
+		if teeErr != nil && writer.teeErrors && err == nil {
+			err = teeErr
+		}
+	}
+
+	return written, err
+}
+
+// exceeded returns true if amount of bytes written into backend reached limit
+// specified by WithMaxTotalBytes.
+func (writer *Writer) exceeded() bool {
+	return writer.maxTotal > 0 && int64(writer.bytes.Load()) >= writer.maxTotal
+}
+
+// delimiter returns byte sequence, that terminates line according to
+// configuration.
+func (writer *Writer) delimiter() []byte {
+	if len(writer.delimiters) > 0 {
+		return writer.delimiters
+	}
+
+	if writer.newline < utf8.RuneSelf {
+		return []byte{byte(writer.newline)}
+	}
+
+	return utf8.AppendRune(nil, writer.newline)
+}
+
+// flushableEnd returns position right after the last byte in the buffer, that
+// can be written into backend even if line is not complete yet.
+func (writer *Writer) flushableEnd() int {
+	// Trailing bytes can be the first part of delimiter, so they are kept
+	// until it's known what follows them.
+	end := len(writer.buffer) - writer.partialDelimiter()
+
+	// Escape sequence can't be stripped until it's complete.
+	if writer.stripANSI {
+		end -= incompleteEscape(writer.buffer[:end])
+	}
+
+	// Rune can't be validated until it's complete.
+	if writer.replacement != nil {
+		end -= incompleteRune(writer.buffer[:end])
+	}
+
+	return end
+}
+
+// partialDelimiter returns length of the longest suffix of the buffer, that
+// is the beginning of multi-byte delimiter.
+func (writer *Writer) partialDelimiter() int {
+	delimiter := writer.terminator
+
+	for size := min(len(delimiter)-1, len(writer.buffer)); size > 0; size-- {
+		if bytes.HasSuffix(writer.buffer, delimiter[:size]) {
+			return size
+		}
+	}
+
+	return 0
+}
+
+// lastLineEnd returns position right after the last complete line in the
+// buffer or zero if buffer has no complete lines.
+//
+// Part of the buffer, that is already searched, is not searched again, so
+// incomplete line, that grows by small writes, or complete lines, that are
+// kept in the buffer, are scanned only once.
+func (writer *Writer) lastLineEnd() int {
+	var (
+		delimiter = writer.terminator
+		offset    = max(writer.scanned-len(delimiter), 0)
+		data      = writer.buffer[offset:]
+		last      int
+	)
+
+	switch {
+	case writer.jsonLines:
+		writer.scannedRecord, last = scanRecords(
+			writer.buffer,
+			writer.scanned,
+			writer.scannedRecord,
+			delimiter,
+		)
+
+	case writer.carriage:
+		if end := lastCarriageEnd(data, delimiter); end > 0 {
+			last = offset + end
+		}
+
+	default:
+		if end := lastDelimiterEnd(data, delimiter); end > 0 {
+			last = offset + end
+		}
+	}
+
+	writer.scanned = len(writer.buffer)
+	writer.ended = max(writer.ended, last)
+
+	return writer.ended
+}
+
+// lastDelimiterEnd returns position right after the last delimiter in given
+// data or zero if data has no delimiters.
+func lastDelimiterEnd(data []byte, delimiter []byte) int {
+	if len(delimiter) == 1 {
+		return bytes.LastIndexByte(data, delimiter[0]) + 1
+	}
+
+	last := bytes.LastIndex(data, delimiter)
+	if last < 0 {
+		return 0
+	}
+
+	return last + len(delimiter)
+}
+
+// discard removes first `size` bytes from the buffer, reusing its memory for
+// remaining data unless buffer should be shrunk.
+func (writer *Writer) discard(size int) {
+	if writer.jsonLines {
+		writer.record, _ = scanRecords(
+			writer.buffer[:size], 0, writer.record, writer.terminator,
+		)
+
+		if writer.scanned <= size {
+			writer.scannedRecord = writer.record
+		}
+	}
+
+	remaining := writer.buffer[size:]
+
+	if writer.shrink > 0 &&
+		cap(writer.buffer) > writer.shrink &&
+		len(remaining) < writer.shrink {
+		// Memory of large buffer is released, so it's not held by writer,
+		// that has seen a huge line once.
+		writer.buffer = append([]byte(nil), remaining...)
+	} else {
+		writer.buffer = writer.buffer[:copy(writer.buffer, remaining)]
+	}
+
+	writer.scanned = max(writer.scanned-size, 0)
+	writer.ended = max(writer.ended-size, 0)
+}
+
+// truncate keeps only first `size` bytes in the buffer.
+func (writer *Writer) truncate(size int) {
+	writer.buffer = writer.buffer[:size]
+
+	// Position of the last line end can't be adjusted, so the buffer is
+	// searched again.
+	if writer.scanned > size {
+		writer.scanned = 0
+		writer.ended = 0
+		writer.scannedRecord = writer.record
+	}
+}
+
+// splitLines splits given buffered data, that begins at the beginning of the
+// buffer, into lines or JSON records and appends them to given lines.
+func (writer *Writer) splitLines(lines [][]byte, data []byte) [][]byte {
+	if writer.jsonLines {
+		return splitRecords(lines, data, writer.record, writer.terminator)
+	}
+
+	if writer.carriage {
+		return splitCarriage(lines, data, writer.terminator)
+	}
+
+	return splitLines(lines, data, writer.terminator)
+}
+
+// splitLines splits given data into lines, that keep trailing delimiter, and
+// appends them to given lines. Last line can be incomplete.
+func splitLines(lines [][]byte, data []byte, delimiter []byte) [][]byte {
+	for len(data) > 0 {
+		end := bytes.Index(data, delimiter)
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += len(delimiter)
+		}
+
+		lines = append(lines, data[:end])
+		data = data[end:]
+	}
 
-	return writer.backend.Close()
+	return lines
 }
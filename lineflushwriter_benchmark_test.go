@@ -3,6 +3,7 @@ package lineflushwriter
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"sync"
 	"testing"
@@ -57,3 +58,166 @@ func BenchmarkWriter_Write_WritesLineAtomically(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkWriter_Write_Lines(b *testing.B) {
+	data := []byte("line\n")
+
+	writer := New(&writeCounter{}, &sync.Mutex{}, false)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer.Write(data)
+	}
+}
+
+func BenchmarkWriter_Write_Lines_Unsynchronized(b *testing.B) {
+	data := []byte("line\n")
+
+	writer := New(&writeCounter{}, nil, false, WithUnsynchronized())
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer.Write(data)
+	}
+}
+
+func BenchmarkWriter_Write_Lines_Prefix(b *testing.B) {
+	data := []byte("line\n")
+
+	writer := New(
+		&writeCounter{}, nil, false,
+		WithPrefix("> "), WithScratchSize(64), WithUnsynchronized(),
+	)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer.Write(data)
+	}
+}
+
+func BenchmarkWriter_WriteString_StringWriterBackend(b *testing.B) {
+	var (
+		backend = &bytes.Buffer{}
+		writer  = New(nopCloser{backend}, nil, false, WithUnsynchronized())
+	)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer.WriteString("partial ")
+		writer.WriteString("line\n")
+
+		if backend.Len() > 1024*1024 {
+			backend.Reset()
+		}
+	}
+}
+
+func BenchmarkWriter_Write_LongLineByteByByte(b *testing.B) {
+	data := []byte("x")
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer := New(&writeCounter{}, nil, false, WithUnsynchronized())
+
+		for j := 0; j < 1024*1024; j++ {
+			writer.Write(data)
+		}
+
+		writer.Write([]byte("\n"))
+	}
+}
+
+func BenchmarkWriter_Write_ChunksWithoutDelimiter(b *testing.B) {
+	var (
+		chunk   = bytes.Repeat([]byte("x"), 10*1024)
+		newline = []byte("\n")
+	)
+
+	writer := New(&writeCounter{}, nil, false, WithUnsynchronized())
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer.Write(chunk)
+
+		if i%100 == 99 {
+			writer.Write(newline)
+		}
+	}
+}
+
+func BenchmarkWriter_WriteByte(b *testing.B) {
+	writer := New(&writeCounter{}, nil, false, WithUnsynchronized())
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if i%80 == 79 {
+			writer.WriteByte('\n')
+		} else {
+			writer.WriteByte('x')
+		}
+	}
+}
+
+func BenchmarkWriter_Write_MediumLines(b *testing.B) {
+	benchmarkMediumLines(b)
+}
+
+func BenchmarkWriter_Write_MediumLines_InitialCapacity(b *testing.B) {
+	benchmarkMediumLines(b, WithInitialCapacity(4096))
+}
+
+func benchmarkMediumLines(b *testing.B, options ...Option) {
+	var (
+		chunk   = bytes.Repeat([]byte("x"), 128)
+		newline = []byte("\n")
+	)
+
+	options = append(options, WithUnsynchronized())
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		writer := New(&writeCounter{}, nil, false, options...)
+
+		for line := 0; line < 16; line++ {
+			for j := 0; j < 24; j++ {
+				writer.Write(chunk)
+			}
+
+			writer.Write(newline)
+		}
+
+		writer.Close()
+	}
+}
+
+func BenchmarkWriter_Fprintf(b *testing.B) {
+	benchmarkFprintf(b)
+}
+
+func BenchmarkWriter_Fprintf_Batch(b *testing.B) {
+	benchmarkFprintf(b, WithBatchBytes(4096))
+}
+
+func benchmarkFprintf(b *testing.B, options ...Option) {
+	counter := &writeCounter{}
+	writer := New(counter, &sync.Mutex{}, false, options...)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		fmt.Fprintf(writer, "%d\n", i)
+	}
+
+	writer.Close()
+
+	b.ReportMetric(float64(counter.Count())/float64(b.N), "writes/op")
+}
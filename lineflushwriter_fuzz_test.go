@@ -0,0 +1,117 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fuzzOptions are options, that change how data is split into backend
+// writes, and whether they keep data itself as is.
+var fuzzOptions = []struct {
+	options []Option
+	keeps   bool
+}{
+	{nil, true},
+	{[]Option{WithMaxBufferBytes(3)}, true},
+	{[]Option{WithBatchBytes(5)}, true},
+	{[]Option{WithSizeOrLineFlush(4)}, true},
+	{[]Option{WithMaxBufferBytes(2), WithRetainOnError()}, true},
+	{[]Option{WithCRLF()}, true},
+	{[]Option{WithMaxLineBytes(3), WithMaxBufferBytes(3)}, false},
+	{[]Option{WithMaxLineBytes(3), WithCRLF()}, false},
+	{[]Option{WithMaxLineBytes(3), WithCarriageReturnAsLine(true)}, false},
+}
+
+// fuzzWrite writes given data into new Writer by chunks of given sizes and
+// returns everything, that was written into backend.
+func fuzzWrite(
+	t *testing.T,
+	data []byte,
+	splits []byte,
+	ensureNewline bool,
+	options []Option,
+) []byte {
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, ensureNewline, options...)
+
+	rest := data
+	for _, split := range splits {
+		size := min(int(split), len(rest))
+
+		written, err := writer.Write(rest[:size])
+		if err != nil || written != size {
+			t.Fatalf("write %q: %d, %v", rest[:size], written, err)
+		}
+
+		rest = rest[size:]
+	}
+
+	if _, err := writer.Write(rest); err != nil {
+		t.Fatalf("write %q: %v", rest, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// FuzzWriteChunking checks, that output doesn't depend on how data is split
+// between write calls. Mode selects options by its high bits, while the
+// lowest bit is `ensureNewline`.
+func FuzzWriteChunking(f *testing.F) {
+	f.Add([]byte("1\n22\n333"), []byte{1, 2, 3}, byte(0))
+	f.Add([]byte("\n\n\r\n"), []byte{0, 1}, byte(2))
+	f.Add([]byte("partial line without newline"), []byte{5}, byte(6))
+	f.Add([]byte("1\r\n2\r"), []byte{1, 1, 1}, byte(10))
+	f.Add([]byte{}, []byte{}, byte(1))
+
+	// Incomplete line is written due to max buffer size before Close.
+	f.Add([]byte("00"), []byte{0}, byte(9))
+	f.Add([]byte("\r"), []byte{0}, byte(11))
+
+	// Line of max line size is terminated by the next write.
+	f.Add([]byte("abc\nd"), []byte{3}, byte(12))
+	f.Add([]byte("abc\r\nx\r\n"), []byte{4}, byte(14))
+	f.Add([]byte("abc\rx\n"), []byte{4}, byte(16))
+
+	f.Fuzz(func(t *testing.T, data []byte, splits []byte, mode byte) {
+		var (
+			ensureNewline = mode&1 == 1
+			fuzz          = fuzzOptions[int(mode>>1)%len(fuzzOptions)]
+		)
+
+		var (
+			expected = fuzzWrite(t, data, nil, ensureNewline, fuzz.options)
+			actual   = fuzzWrite(t, data, splits, ensureNewline, fuzz.options)
+		)
+
+		if !bytes.Equal(expected, actual) {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+
+		if !fuzz.keeps {
+			return
+		}
+
+		// Incomplete delimiter at the end of data is completed.
+		writer := New(nopCloser{&bytes.Buffer{}}, nil, false, fuzz.options...)
+		delimiter := writer.Config().Delimiter
+
+		expected = append([]byte(nil), data...)
+		if ensureNewline && len(expected) > 0 &&
+			!bytes.HasSuffix(expected, delimiter) {
+			size := len(delimiter) - 1
+			for !bytes.HasSuffix(expected, delimiter[:size]) {
+				size--
+			}
+
+			expected = append(expected, delimiter[size:]...)
+		}
+
+		if !bytes.Equal(expected, actual) {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	})
+}
@@ -2,9 +2,17 @@ package lineflushwriter
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +26,8 @@ func (closer nopCloser) Close() error {
 }
 
 type writeCounter struct {
-	count int
+	count  int
+	closes int
 }
 
 func (counter *writeCounter) Write(data []byte) (int, error) {
@@ -27,6 +36,7 @@ func (counter *writeCounter) Write(data []byte) (int, error) {
 }
 
 func (counter *writeCounter) Close() error {
+	counter.closes++
 	return nil
 }
 
@@ -34,16 +44,237 @@ func (counter *writeCounter) Count() int {
 	return counter.count
 }
 
+type limitWriter struct {
+	*bytes.Buffer
+	limit  int
+	closed bool
+}
+
+func (writer *limitWriter) Write(data []byte) (int, error) {
+	if writer.Len()+len(data) > writer.limit {
+		written, _ := writer.Buffer.Write(data[:writer.limit-writer.Len()])
+		return written, errors.New("limit reached")
+	}
+
+	return writer.Buffer.Write(data)
+}
+
+func (writer *limitWriter) Close() error {
+	writer.closed = true
+	return nil
+}
+
 func TestNew_ReturnsWriterWithSpecifiedValues(t *testing.T) {
 	test := assert.New(t)
 
 	mutex := &sync.Mutex{}
-	writer := New(nil, mutex, true)
+	writer := New(nopCloser{&bytes.Buffer{}}, mutex, true)
+
+	test.Equal(mutex, writer.lock)
+	test.Equal(true, writer.ensureNewline)
+	test.Equal('\n', writer.newline)
+}
+
+func TestNew_PanicsIfBackendIsNil(t *testing.T) {
+	test := assert.New(t)
+
+	test.PanicsWithError(ErrNilBackend.Error(), func() {
+		New(nil, nil, false)
+	})
+}
+
+func TestNewChecked_ReturnsErrorIfBackendIsNil(t *testing.T) {
+	test := assert.New(t)
+
+	writer, err := NewChecked(nil, nil, false)
+	test.True(errors.Is(err, ErrNilBackend))
+	test.Nil(writer)
+
+	writer, err = NewChecked(nopCloser{&bytes.Buffer{}}, nil, true)
+	test.NoError(err)
+	test.True(writer.ensureNewline)
+}
+
+func TestNew_UsesOwnMutexIfLockIsNil(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false)
+
+	test.NotNil(writer.lock)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				writer.Write([]byte("12"))
+				writer.Write([]byte("3\n"))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	test.Equal(1000*len("123\n"), buffer.Len())
+}
+
+func TestNew_SkipsLockingIfUnsynchronized(t *testing.T) {
+	test := assert.New(t)
+
+	mutex := &sync.Mutex{}
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, mutex, false, WithUnsynchronized())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	writer.Write([]byte("1\n"))
+	test.Equal("1\n", buffer.String())
+}
+
+func TestWriter_KeepsLinesOfSingleWriteContiguous(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		mutex  = &sync.Mutex{}
+		buffer = &bytes.Buffer{}
+		wg     = sync.WaitGroup{}
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			writer := New(nopCloser{buffer}, mutex, false)
+
+			for j := 0; j < 100; j++ {
+				writer.Write([]byte(strings.Repeat(fmt.Sprintf("%d\n", id), 5)))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	test.Len(lines, 10*100*5)
+
+	for i := 0; i < len(lines); i += 5 {
+		for j := i + 1; j < i+5; j++ {
+			test.Equal(lines[i], lines[j], "line %d", j)
+		}
+	}
+}
+
+func TestWriter_NeverSplitsLinesOfConcurrentWriters(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		mutex  = &sync.Mutex{}
+		buffer = &bytes.Buffer{}
+		wg     = sync.WaitGroup{}
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			writer := New(nopCloser{buffer}, mutex, true)
+			defer writer.Close()
+
+			line := fmt.Sprintf("writer %02d line", id)
+
+			for j := 0; j < 200; j++ {
+				for _, part := range strings.SplitAfter(line, " ") {
+					writer.Write([]byte(part))
+				}
+
+				writer.Write([]byte("\n" + line[:j%len(line)]))
+				writer.Write([]byte(line[j%len(line):]))
+				writer.Write([]byte("\n"))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	test.Len(lines, 50*200*2)
+
+	for i, line := range lines {
+		test.Regexp(`^writer \d\d line$`, line, "line %d", i)
+	}
+}
+
+func TestNewWithDelimiter_ReturnsWriterWithSpecifiedDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	writer := NewWithDelimiter(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false, 0,
+	)
+
+	test.Equal(rune(0), writer.newline)
+}
+
+func TestNewWriter_ReturnsWriterWithDefaultValues(t *testing.T) {
+	test := assert.New(t)
+
+	writer := NewWriter(nil)
+
+	test.NotNil(writer.lock)
+	test.Equal(false, writer.ensureNewline)
+	test.Equal('\n', writer.newline)
+	test.Empty(writer.prefix)
+}
+
+func TestNewWriter_ReturnsWriterWithSpecifiedOptions(t *testing.T) {
+	test := assert.New(t)
+
+	mutex := &sync.Mutex{}
+	writer := NewWriter(
+		nil,
+		WithLock(mutex),
+		WithEnsureNewline(true),
+		WithDelimiter(0),
+		WithPrefix("> "),
+	)
+
+	test.Equal(mutex, writer.lock)
+	test.Equal(true, writer.ensureNewline)
+	test.Equal(rune(0), writer.newline)
+	test.Equal("> ", string(writer.prefix))
+}
+
+func TestNewFromWriter_ReturnsWriterWithSpecifiedValues(t *testing.T) {
+	test := assert.New(t)
+
+	mutex := &sync.Mutex{}
+	buffer := &bytes.Buffer{}
+	writer := NewFromWriter(buffer, mutex, true)
 
+	test.Equal(buffer, writer.backend)
 	test.Equal(mutex, writer.lock)
 	test.Equal(true, writer.ensureNewline)
 }
 
+func TestWriter_FlushesBufferOnCloseIntoBackendWithoutClose(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := NewFromWriter(buffer, nil, true)
+
+	writer.Write([]byte("1\n2"))
+	test.NoError(writer.Close())
+	test.Equal("1\n2\n", buffer.String())
+}
+
 func TestWriter_WritesNothingAtEmptyData(t *testing.T) {
 	testWriter(t, nil, false, "", "")
 }
@@ -52,6 +283,25 @@ func TestWriter_WritesSingleNewLine(t *testing.T) {
 	testWriter(t, nil, false, "\n", "\n")
 }
 
+func TestWriter_WritesConsecutiveNewLinesImmediately(t *testing.T) {
+	test := assert.New(t)
+
+	writer := testWriter(t, nil, false, "\n\n", "\n\n")
+	test.Equal(0, writer.(*Writer).Buffered())
+
+	_ = testWriter(t, writer, false, "\n", "\n\n\n")
+}
+
+func TestWriter_WritesConsecutiveNewLinesWithPrefixImmediately(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false, WithPrefix("> "))
+
+	writer.Write([]byte("\n\n"))
+	test.Equal("> \n> \n", buffer.String())
+}
+
 func TestWriter_WritesNothingIfLineIsNotComplete(t *testing.T) {
 	testWriter(t, nil, false, "123", "")
 }
@@ -107,6 +357,2575 @@ func TestWriter_CallBackendWriteOnlyOncePerOriginalCall(t *testing.T) {
 	assert.Equal(t, 1, counter.count)
 }
 
+func TestWriter_DoNotKeepReferenceToWrittenData(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, true)
+
+	data := []byte("1\n2\n3")
+
+	written, err := writer.Write(data)
+	test.NoError(err)
+	test.Equal(len(data), written)
+	test.Equal("1\n2\n", buffer.String())
+
+	copy(data, "xxxxx")
+
+	writer.Close()
+	test.Equal("1\n2\n3\n", buffer.String())
+	test.Equal("xxxxx", string(data))
+}
+
+func TestWriter_CallBackendWriteOnlyOncePerOriginalCallWithPrefix(
+	t *testing.T,
+) {
+	counter := &writeCounter{}
+
+	writer := New(
+		counter, &sync.Mutex{}, true,
+		WithPrefix("> "), WithLineNumbers(1), WithLineFunc(bytes.ToUpper),
+	)
+	writer.Write([]byte("a\nb\nc\nd"))
+	assert.Equal(t, 1, counter.count)
+}
+
+func TestWriter_WritesCompleteLinesInOrderForAnyChunkSize(t *testing.T) {
+	test := assert.New(t)
+
+	for _, data := range []string{
+		"1\n",
+		"1\n2\n3",
+		"123\n\n456\n78\n9",
+		"\n\n1\n\n",
+	} {
+		for size := 1; size <= len(data); size++ {
+			buffer := &bytes.Buffer{}
+			writer := New(nopCloser{buffer}, &sync.Mutex{}, false)
+
+			for offset := 0; offset < len(data); offset += size {
+				chunk := data[offset:min(offset+size, len(data))]
+
+				written, err := writer.Write([]byte(chunk))
+				test.NoError(err)
+				test.Equal(len(chunk), written)
+
+				expected := data[:offset+len(chunk)]
+				expected = expected[:strings.LastIndex(expected, "\n")+1]
+
+				test.Equal(expected, buffer.String(), "%q by %d", data, size)
+			}
+
+			writer.Close()
+			test.Equal(data, buffer.String(), "%q by %d", data, size)
+		}
+	}
+}
+
+func TestWriter_ReturnsLengthOfDataWhenWritingSeveralLines(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+
+	written, err := writer.Write([]byte("1\n2\n3\n4"))
+	test.NoError(err)
+	test.Equal(7, written)
+}
+
+func TestWriter_ReturnsBytesOfDataWrittenToBackendOnError(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 6}
+	writer := New(backend, &sync.Mutex{}, false)
+
+	written, err := writer.Write([]byte("12"))
+	test.NoError(err)
+	test.Equal(2, written)
+
+	written, err = writer.Write([]byte("3\n45\n6"))
+	test.Error(err)
+	test.Equal(4, written)
+	test.Equal("123\n45", backend.String())
+	test.Empty(writer.buffer)
+}
+
+func TestWriter_ReturnsConsumedBytesForAnyBackendFailurePosition(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	for limit := 0; limit < 9; limit++ {
+		backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: limit}
+		writer := New(backend, &sync.Mutex{}, false)
+
+		writer.Write([]byte("12"))
+
+		written, err := writer.Write([]byte("3\n45\n6"))
+		if limit < 7 {
+			test.Error(err, "limit %d", limit)
+		} else {
+			test.NoError(err, "limit %d", limit)
+		}
+
+		test.Equal(
+			"123\n45\n6"[:len(backend.String())],
+			backend.String(),
+			"limit %d", limit,
+		)
+
+		test.Equal(
+			"12"+"3\n45\n6"[:written],
+			backend.String()+string(writer.buffer),
+			"limit %d", limit,
+		)
+	}
+}
+
+type flakyWriter struct {
+	*bytes.Buffer
+	failures int
+}
+
+func (writer *flakyWriter) Write(data []byte) (int, error) {
+	if writer.failures > 0 {
+		writer.failures--
+
+		written, _ := writer.Buffer.Write(data[:len(data)/2])
+
+		return written, errors.New("temporary error")
+	}
+
+	return writer.Buffer.Write(data)
+}
+
+func TestWriter_RetainsUnwrittenDataOnErrorIfRequested(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &flakyWriter{Buffer: &bytes.Buffer{}, failures: 1}
+	writer := NewFromWriter(backend, nil, false, WithRetainOnError())
+
+	written, err := writer.Write([]byte("12\n34\n5"))
+	test.EqualError(err, "flush line 2 (offset 3): temporary error")
+	test.Equal(7, written)
+	test.Equal("12\n", backend.String())
+
+	written, err = writer.Write([]byte("6\n7"))
+	test.NoError(err)
+	test.Equal(3, written)
+	test.Equal("12\n34\n56\n", backend.String())
+
+	backend.failures = 1
+
+	test.Error(writer.Flush())
+	test.NoError(writer.Flush())
+	test.Equal("12\n34\n56\n7", backend.String())
+}
+
+func TestWriter_WritesRetainedDataBeforeNewDataAfterError(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &flakyWriter{Buffer: &bytes.Buffer{}, failures: 2}
+	writer := NewFromWriter(backend, nil, false, WithRetainOnError())
+
+	_, err := writer.Write([]byte("abcd\nef\n"))
+	test.Error(err)
+	test.Equal("abcd", backend.String())
+
+	_, err = writer.Write([]byte("gh\n"))
+	test.Error(err)
+	test.Equal("abcd\nef", backend.String())
+
+	_, err = writer.Write([]byte("ij\n"))
+	test.NoError(err)
+	test.Equal("abcd\nef\ngh\nij\n", backend.String())
+	test.Zero(writer.Buffered())
+}
+
+func TestWriter_DrainsOnlyCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &flakyWriter{Buffer: &bytes.Buffer{}, failures: 1}
+	writer := NewFromWriter(backend, nil, false, WithRetainOnError())
+
+	writer.Write([]byte("a\nb\nc"))
+	test.Equal("a\n", backend.String())
+	test.Equal(3, writer.Buffered())
+
+	test.NoError(writer.Drain())
+	test.Equal("a\nb\n", backend.String())
+	test.Equal(1, writer.Buffered())
+
+	test.NoError(writer.Drain())
+	test.Equal("a\nb\n", backend.String())
+}
+
+type invalidWriter struct{}
+
+func (invalidWriter) Write(data []byte) (int, error) {
+	return len(data) + 1, nil
+}
+
+func TestWriter_ReturnsErrorIfBackendReturnsInvalidCount(t *testing.T) {
+	test := assert.New(t)
+
+	writer := NewFromWriter(invalidWriter{}, nil, false)
+
+	written, err := writer.Write([]byte("1\n"))
+	test.True(errors.Is(err, errInvalidWrite))
+	test.Equal(0, written)
+}
+
+type halfWriter struct {
+	*bytes.Buffer
+}
+
+func (writer halfWriter) Write(data []byte) (int, error) {
+	return writer.Buffer.Write(data[:len(data)/2])
+}
+
+func TestWriter_ReturnsShortWriteErrorIfBackendWritesPartially(t *testing.T) {
+	test := assert.New(t)
+
+	backend := halfWriter{&bytes.Buffer{}}
+	writer := NewFromWriter(backend, nil, false)
+
+	written, err := writer.Write([]byte("12\n3\n"))
+	test.True(errors.Is(err, io.ErrShortWrite))
+	test.Equal(2, written)
+	test.Equal("12", backend.String())
+}
+
+func TestWriter_ReturnsErrorWithPositionOfUnwrittenLine(t *testing.T) {
+	test := assert.New(t)
+
+	for _, options := range [][]Option{nil, {WithPrefix("> ")}} {
+		backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 5}
+		if options != nil {
+			backend.limit = 11
+		}
+
+		writer := New(backend, nil, false, options...)
+
+		written, err := writer.Write([]byte("1\n22\n333\n4\n"))
+		test.EqualError(err, "flush line 3 (offset 5): limit reached")
+		test.Equal(5, written)
+	}
+}
+
+func TestWriter_ReturnsErrorWithPositionWithinCurrentWrite(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 7}
+	writer := New(backend, nil, false)
+
+	writer.Write([]byte("ab"))
+
+	written, err := writer.Write([]byte("c\n22\n333\n"))
+	test.EqualError(err, "flush line 3 (offset 5): limit reached")
+	test.Equal(5, written)
+	test.Equal("abc\n22\n", backend.String())
+}
+
+type errorWriter struct {
+	err error
+}
+
+func (writer errorWriter) Write(data []byte) (int, error) {
+	return 0, writer.err
+}
+
+func TestWriter_ReturnsErrorMatchingBackendError(t *testing.T) {
+	test := assert.New(t)
+
+	writer := NewFromWriter(errorWriter{io.ErrClosedPipe}, nil, false)
+
+	_, err := writer.Write([]byte("1\n"))
+	test.True(errors.Is(err, io.ErrClosedPipe))
+}
+
+func TestWriter_KeepsPendingDataIfBackendFailsBeforeReachingNewData(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 1}
+	writer := New(backend, &sync.Mutex{}, false)
+
+	writer.Write([]byte("12"))
+
+	written, err := writer.Write([]byte("3\n"))
+	test.Error(err)
+	test.Equal(0, written)
+	test.Equal("1", backend.String())
+	test.Equal("2", string(writer.buffer))
+}
+
+func TestWriter_WritesLinesEndingWithCustomDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := NewWithDelimiter(nopCloser{buffer}, &sync.Mutex{}, false, 0)
+
+	writer.Write([]byte("1\x002\n\x003"))
+	test.Equal("1\x002\n\x00", buffer.String())
+}
+
+func TestWriter_EnsuresExactlyOneNewlineAtEndOfOutput(t *testing.T) {
+	test := assert.New(t)
+
+	for data, expected := range map[string]string{
+		"":             "",
+		"1":            "1\n",
+		"1\n":          "1\n",
+		"1\n\n\n":      "1\n",
+		"\n\n":         "\n",
+		"1\n\n2\n\n\n": "1\n\n2\n",
+		"1\n\n\n2":     "1\n\n\n2\n",
+	} {
+		buffer := &bytes.Buffer{}
+		writer := New(
+			nopCloser{buffer}, nil, false,
+			WithEnsureNewlineAlways(),
+		)
+
+		for i := range data {
+			writer.Write([]byte(data[i : i+1]))
+		}
+
+		writer.Close()
+		test.Equal(expected, buffer.String(), data)
+	}
+}
+
+func TestWriter_TerminatesFlushedLineOnCloseIfEnsuresNewlineAlways(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithEnsureNewlineAlways())
+
+	writer.Write([]byte("1\n\n2"))
+	writer.Flush()
+	test.Equal("1\n\n2", buffer.String())
+
+	writer.Close()
+	test.Equal("1\n\n2\n", buffer.String())
+}
+
+func TestWriter_CanEnsureCustomDelimiterAtEndOfTheStringOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := NewWithDelimiter(nopCloser{buffer}, &sync.Mutex{}, true, 0)
+
+	writer.Write([]byte("1\x002\n"))
+	writer.Close()
+	test.Equal("1\x002\n\x00", buffer.String())
+}
+
+type blockingWriter struct {
+	*bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (writer *blockingWriter) Write(data []byte) (int, error) {
+	close(writer.started)
+	<-writer.release
+
+	return writer.Buffer.Write(data)
+}
+
+func (writer *blockingWriter) Close() error {
+	return nil
+}
+
+func TestWriter_DoNotWaitForSharedLockToBufferIncompleteLine(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		mutex   = &sync.Mutex{}
+		backend = &blockingWriter{
+			Buffer:  &bytes.Buffer{},
+			started: make(chan struct{}),
+			release: make(chan struct{}),
+		}
+		first  = New(backend, mutex, false)
+		second = New(backend, mutex, false)
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		first.Write([]byte("1\n"))
+		close(done)
+	}()
+
+	<-backend.started
+
+	written, err := second.Write([]byte("2"))
+	test.NoError(err)
+	test.Equal(1, written)
+	test.Equal(1, second.Buffered())
+
+	close(backend.release)
+	<-done
+
+	test.Equal("1\n", backend.String())
+}
+
+func TestWriter_WriteContextReturnsErrorIfContextIsDone(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	written, err := writer.WriteContext(ctx, []byte("1\n2"))
+	test.NoError(err)
+	test.Equal(3, written)
+
+	cancel()
+
+	written, err = writer.WriteContext(ctx, []byte("3\n"))
+	test.Equal(context.Canceled, err)
+	test.Equal(0, written)
+	test.Equal("1\n", buffer.String())
+	test.Equal(1, writer.Buffered())
+}
+
+// cancelingWriter cancels context after every write.
+type cancelingWriter struct {
+	*bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (writer *cancelingWriter) Write(data []byte) (int, error) {
+	defer writer.cancel()
+
+	return writer.Buffer.Write(data)
+}
+
+func TestWriter_WriteContextStopsWritingLinesIfContextIsDone(t *testing.T) {
+	test := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	backend := &cancelingWriter{Buffer: &bytes.Buffer{}, cancel: cancel}
+	writer := NewFromWriter(backend, &sync.Mutex{}, false)
+
+	written, err := writer.WriteContext(ctx, []byte("1\n2\n3\n"))
+	test.Equal(context.Canceled, err)
+	test.Equal(2, written)
+	test.Equal("1\n", backend.String())
+
+	// Context error is not sticky.
+	_, err = writer.Write([]byte("4\n"))
+	test.NoError(err)
+	test.Equal("1\n4\n", backend.String())
+}
+
+func TestWriter_WriteStringWritesOnlyCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false)
+
+	written, err := io.WriteString(writer, "1\n2")
+	test.NoError(err)
+	test.Equal(3, written)
+	test.Equal("1\n", buffer.String())
+
+	written, err = writer.WriteString("3\n")
+	test.NoError(err)
+	test.Equal(2, written)
+	test.Equal("1\n23\n", buffer.String())
+}
+
+func TestWriter_ReadFromWritesOnlyCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false)
+
+	data := strings.Repeat("1234567\n", readChunkSize/4) + "89"
+
+	read, err := io.Copy(writer, strings.NewReader(data))
+	test.NoError(err)
+	test.Equal(int64(len(data)), read)
+	test.Equal(data[:len(data)-2], buffer.String())
+	test.Equal(2, writer.Buffered())
+}
+
+func TestWriter_ReadFromReturnsReaderError(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false)
+
+	reader := io.MultiReader(
+		strings.NewReader("1\n2"),
+		iotest.ErrReader(errors.New("read error")),
+	)
+
+	read, err := writer.ReadFrom(reader)
+	test.EqualError(err, "read error")
+	test.Equal(int64(3), read)
+	test.Equal("1\n", buffer.String())
+}
+
+type syncWriter struct {
+	*bytes.Buffer
+	synced string
+}
+
+func (writer *syncWriter) Sync() error {
+	writer.synced = writer.String()
+	return nil
+}
+
+func TestWriter_SyncsBackendAfterFlush(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &syncWriter{Buffer: &bytes.Buffer{}}
+	writer := NewFromWriter(backend, nil, false)
+
+	writer.Write([]byte("1\n2"))
+	test.NoError(writer.Sync())
+	test.Equal("1\n2", backend.synced)
+}
+
+func TestWriter_SyncFlushesIntoBackendWithoutSync(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := NewFromWriter(buffer, nil, false)
+
+	writer.Write([]byte("1\n2"))
+	test.NoError(writer.Sync())
+	test.Equal("1\n2", buffer.String())
+}
+
+func TestWriter_ReturnsAmountOfBufferedBytes(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+	test.Equal(0, writer.Buffered())
+
+	writer.Write([]byte("1\n23"))
+	test.Equal(2, writer.Buffered())
+
+	writer.Close()
+	test.Equal(0, writer.Buffered())
+}
+
+type slowWriter struct {
+	*bytes.Buffer
+	delay time.Duration
+}
+
+func (writer *slowWriter) Write(data []byte) (int, error) {
+	time.Sleep(writer.delay)
+
+	return writer.Buffer.Write(data)
+}
+
+func TestWriter_ReportsDurationOfEveryBackendWrite(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		durations []time.Duration
+		sizes     []int
+	)
+
+	backend := &slowWriter{
+		Buffer: &bytes.Buffer{},
+		delay:  10 * time.Millisecond,
+	}
+	writer := NewFromWriter(
+		backend, &sync.Mutex{}, false,
+		WithWriteTimingHook(func(duration time.Duration, written int) {
+			durations = append(durations, duration)
+			sizes = append(sizes, written)
+		}),
+	)
+
+	writer.Write([]byte("1\n2\n3"))
+	writer.Write([]byte("4"))
+	test.Equal([]int{4}, sizes)
+
+	writer.Close()
+	test.Equal([]int{4, 2}, sizes)
+
+	for _, duration := range durations {
+		test.True(duration >= backend.delay, duration)
+	}
+}
+
+func TestWriter_ReturnsHighWaterMarkOfBufferedBytes(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithShrinkThreshold(4),
+	)
+	test.Equal(0, writer.MaxBuffered())
+
+	writer.Write([]byte("1\n23"))
+	test.Equal(2, writer.MaxBuffered())
+
+	writer.Write([]byte("45678\n9"))
+	test.Equal(1, writer.Buffered())
+	test.Equal(9, writer.MaxBuffered())
+
+	writer.Reset(nopCloser{&bytes.Buffer{}})
+	writer.Write([]byte("123"))
+	test.Equal(9, writer.MaxBuffered())
+}
+
+func TestWriter_ReturnsCopyOfBufferedData(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, nil, false)
+	test.Empty(writer.Peek())
+
+	writer.Write([]byte("1\n23"))
+
+	data := writer.Peek()
+	test.Equal([]byte("23"), data)
+
+	writer.Write([]byte("4"))
+	test.Equal([]byte("23"), data)
+
+	data[0] = 'x'
+	test.Equal([]byte("234"), writer.Peek())
+}
+
+func TestWriter_WritesBufferedDataIntoGivenWriter(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, nil, false)
+
+	var _ io.WriterTo = writer
+
+	dump := &bytes.Buffer{}
+
+	written, err := writer.WriteTo(dump)
+	test.NoError(err)
+	test.Zero(written)
+
+	writer.Write([]byte("1\n23"))
+
+	written, err = writer.WriteTo(dump)
+	test.NoError(err)
+	test.EqualValues(2, written)
+	test.Equal("23", dump.String())
+	test.Equal([]byte("23"), writer.Peek())
+
+	written, err = writer.WriteTo(
+		&limitWriter{Buffer: &bytes.Buffer{}, limit: 1},
+	)
+	test.Error(err)
+	test.EqualValues(1, written)
+}
+
+func TestWriter_BuffersRemainderWithoutTrailingDelimiterAsIs(t *testing.T) {
+	test := assert.New(t)
+
+	for _, data := range []string{
+		"1",
+		"1\n2",
+		"1\n\x00\xff\r",
+		"1\n2\n3 4  ",
+	} {
+		buffer := &bytes.Buffer{}
+		writer := New(nopCloser{buffer}, nil, false)
+
+		written, err := writer.Write([]byte(data))
+		test.NoError(err)
+		test.Equal(len(data), written)
+
+		end := strings.LastIndex(data, "\n") + 1
+
+		test.Equal(data[:end], buffer.String(), "%q", data)
+		test.Equal([]byte(data[end:]), writer.Peek(), "%q", data)
+
+		writer.Write([]byte("\n"))
+		test.Equal(data+"\n", buffer.String(), "%q", data)
+	}
+}
+
+func TestWriter_ReportsWhetherIncompleteLineIsPending(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+	test.False(writer.PendingPartial())
+
+	writer.Write([]byte("1\n2"))
+	test.True(writer.PendingPartial())
+
+	writer.Write([]byte("\n"))
+	test.False(writer.PendingPartial())
+}
+
+func TestWriter_FlushesIncompleteLineOnFlush(t *testing.T) {
+	test := assert.New(t)
+
+	writer := testWriter(t, nil, false, "1\n23", "1\n")
+
+	test.NoError(writer.(*Writer).Flush())
+
+	_ = testWriter(t, writer, false, "4\n5", "1\n234\n")
+	testWriterClose(t, writer, "1\n234\n5")
+}
+
+func TestWriter_RewritesIncompleteLineWrittenByFlushPartial(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\nloading"))
+	test.NoError(writer.FlushPartial())
+	test.Equal("> 1\n> loading", buffer.String())
+	test.Equal([]byte("loading"), writer.Peek())
+
+	writer.Write([]byte("... done\n2"))
+	test.Equal("> 1\n> loading\r> loading... done\n", buffer.String())
+
+	writer.Close()
+	test.Equal("> 1\n> loading\r> loading... done\n> 2", buffer.String())
+}
+
+type chunkRecorder struct {
+	chunks []string
+}
+
+func (recorder *chunkRecorder) Write(data []byte) (int, error) {
+	recorder.chunks = append(recorder.chunks, string(data))
+	return len(data), nil
+}
+
+func TestWriter_SerializesFlushWithConcurrentWrites(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		backend = &chunkRecorder{}
+		writer  = NewFromWriter(backend, nil, false)
+		done    = make(chan struct{})
+		wg      = sync.WaitGroup{}
+	)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			default:
+				writer.Flush()
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		writer.Write([]byte("1\n2\n3"))
+		writer.Write([]byte("\n"))
+	}
+
+	close(done)
+	wg.Wait()
+
+	for _, chunk := range backend.chunks {
+		test.Contains([]string{"1\n2\n", "3", "3\n", "\n"}, chunk)
+	}
+
+	test.Equal(
+		strings.Repeat("1\n2\n3\n", 1000),
+		strings.Join(backend.chunks, ""),
+	)
+}
+
+func TestWriter_DoNotCallBackendOnFlushIfNothingBuffered(t *testing.T) {
+	counter := &writeCounter{}
+
+	writer := New(counter, &sync.Mutex{}, false)
+	writer.Write([]byte("1\n"))
+	writer.Flush()
+	assert.Equal(t, 1, counter.count)
+}
+
+func TestWriter_DoNotCallBackendOnEmptyWrite(t *testing.T) {
+	test := assert.New(t)
+
+	for _, options := range [][]Option{
+		nil,
+		{WithMaxBufferBytes(2)},
+		{WithForceLinePerWrite(), WithSoftFlushDelimiter([]byte("."))},
+	} {
+		counter := &writeCounter{}
+
+		writer := New(counter, &sync.Mutex{}, false, options...)
+		writer.Write([]byte("1"))
+
+		written, err := writer.Write(nil)
+		test.NoError(err)
+		test.Zero(written)
+
+		written, err = writer.WriteString("")
+		test.NoError(err)
+		test.Zero(written)
+
+		test.Equal(0, counter.count)
+		test.Equal([]byte("1"), writer.Peek())
+	}
+}
+
+func TestWriter_WritesOnlyLinesEndingWithCRLFInCRLFMode(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false, WithCRLF())
+
+	writer.Write([]byte("1\r\n2\n3\r"))
+	test.Equal("1\r\n", buffer.String())
+
+	writer.Write([]byte("\n4"))
+	test.Equal("1\r\n2\n3\r\n", buffer.String())
+}
+
+func TestWriter_KeepsTrailingCarriageReturnOnFlushInCRLFMode(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false, WithCRLF())
+
+	writer.Write([]byte("1\r"))
+	writer.Flush()
+	test.Equal("1", buffer.String())
+
+	writer.Write([]byte("\n"))
+	test.Equal("1\r\n", buffer.String())
+}
+
+func TestWriter_CanEnsureCRLFAtEndOfTheStringOnCloseInCRLFMode(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, true, WithCRLF())
+
+	writer.Write([]byte("1\n2"))
+	writer.Close()
+	test.Equal("1\n2\r\n", buffer.String())
+
+	buffer.Reset()
+	writer = New(nopCloser{buffer}, &sync.Mutex{}, true, WithCRLF())
+
+	writer.Write([]byte("1\r"))
+	writer.Close()
+	test.Equal("1\r\n", buffer.String())
+}
+
+func TestWriter_EnsuresRecordTerminatorAtEndOfOutputOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	for data, expected := range map[string]string{
+		"1<EOR>2":      "1<EOR>2<EOR>",
+		"1<EOR>2<EO":   "1<EOR>2<EOR>",
+		"1<EOR>2<EOR>": "1<EOR>2<EOR>",
+	} {
+		buffer := &bytes.Buffer{}
+		writer := New(
+			nopCloser{buffer}, nil, true,
+			WithDelimiterBytes([]byte("<EOR>")),
+		)
+
+		writer.Write([]byte(data))
+		writer.Close()
+		test.Equal(expected, buffer.String(), data)
+	}
+}
+
+func TestWriter_WritesLinesEndingWithMultiByteDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithDelimiterBytes([]byte("\x1e\n")),
+	)
+
+	writer.Write([]byte("1\x1e\n2\n3\x1e"))
+	test.Equal("1\x1e\n", buffer.String())
+
+	writer.Write([]byte("\n4\x1e"))
+	test.Equal("1\x1e\n2\n3\x1e\n", buffer.String())
+
+	writer.Flush()
+	test.Equal("1\x1e\n2\n3\x1e\n4", buffer.String())
+
+	writer.Close()
+	test.Equal("1\x1e\n2\n3\x1e\n4\x1e\n", buffer.String())
+}
+
+func TestWriter_WritesLinesEndingWithMultiByteRuneDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := NewWithDelimiter(nopCloser{buffer}, &sync.Mutex{}, true, '¶')
+
+	writer.Write([]byte("1¶2\xc2\xb73\xc2"))
+	test.Equal("1¶", buffer.String())
+
+	writer.Write([]byte("\xb64"))
+	test.Equal("1¶2\xc2\xb73¶", buffer.String())
+
+	writer.Close()
+	test.Equal("1¶2\xc2\xb73¶4¶", buffer.String())
+}
+
+func TestWriter_ChangesDelimiterBetweenWrites(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, true)
+
+	writer.Write([]byte("header: 1\nheader: 2\nbo"))
+	test.Equal("header: 1\nheader: 2\n", buffer.String())
+
+	test.NoError(writer.SetDelimiter(0))
+	test.Equal(rune(0), writer.Delimiter())
+
+	writer.Write([]byte("dy 1\n\x00body 2"))
+	test.Equal("header: 1\nheader: 2\nbody 1\n\x00", buffer.String())
+
+	writer.Close()
+	test.Equal(
+		"header: 1\nheader: 2\nbody 1\n\x00body 2\x00",
+		buffer.String(),
+	)
+}
+
+func TestWriter_RejectsDelimiterContainedInIncompleteLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false)
+
+	writer.Write([]byte("1\n2;3"))
+
+	err := writer.SetDelimiter(';')
+	test.Equal(ErrAmbiguousDelimiter, err)
+	test.Equal('\n', writer.Delimiter())
+	test.Equal("1\n", buffer.String())
+
+	writer.Write([]byte("\n"))
+	test.Equal("1\n2;3\n", buffer.String())
+}
+
+func TestWriter_TrimsTrailingSpaceBeforeDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithTrimTrailingSpace())
+
+	writer.Write([]byte("  1 \t 2 \t\n \t \n\n3  "))
+	test.Equal("  1 \t 2\n\n\n", buffer.String())
+
+	writer.Write([]byte(" 4 "))
+	test.Equal("  1 \t 2\n\n\n", buffer.String())
+
+	writer.Close()
+	test.Equal("  1 \t 2\n\n\n3   4", buffer.String())
+}
+
+func TestWriter_TrimsTrailingSpaceOnEnsuredNewline(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, true, WithTrimTrailingSpace())
+
+	writer.Write([]byte("1 \n2\t"))
+	test.Equal("1\n", buffer.String())
+
+	writer.Close()
+	test.Equal("1\n2\n", buffer.String())
+}
+
+func TestWriter_StripsDelimiterFromCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithStripDelimiter())
+
+	writer.Write([]byte("1\n\n2\n3"))
+	test.Equal("12", buffer.String())
+
+	writer.Close()
+	test.Equal("123", buffer.String())
+}
+
+func TestWriter_StripsDelimiterAccordingToDrainOptions(t *testing.T) {
+	test := assert.New(t)
+
+	testcases := []struct {
+		global   bool
+		strip    bool
+		drained  string
+		flushed  string
+		expected string
+	}{
+		{false, false, "1\n2\n", "1\n2\n3", "1\n2\n3\n4\n"},
+		{false, true, "12", "123", "123\n4\n"},
+		{true, false, "1\n2\n", "1\n2\n3", "1\n2\n34"},
+		{true, true, "12", "123", "1234"},
+	}
+
+	for _, testcase := range testcases {
+		options := []Option{WithBatchBytes(100)}
+		if testcase.global {
+			options = append(options, WithStripDelimiter())
+		}
+
+		buffer := &bytes.Buffer{}
+		writer := New(nopCloser{buffer}, nil, false, options...)
+
+		opts := DrainOpts{StripDelimiter: testcase.strip}
+
+		writer.Write([]byte("1\n2\n3"))
+		test.NoError(writer.DrainWithOpts(opts))
+		test.Equal(testcase.drained, buffer.String())
+
+		test.NoError(writer.FlushWithOpts(opts))
+		test.Equal(testcase.flushed, buffer.String())
+
+		writer.Write([]byte("\n4\n"))
+		writer.Close()
+		test.Equal(testcase.expected, buffer.String())
+	}
+}
+
+func TestWriter_StripsMultiByteDelimiterFromCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, true,
+		WithCRLF(), WithStripDelimiter(), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\r\n2\n\r\n3\r"))
+	test.Equal("> 1> 2\n", buffer.String())
+
+	writer.Close()
+	test.Equal("> 1> 2\n> 3\r\n", buffer.String())
+
+	writer.Reset(nopCloser{buffer})
+	writer.Write([]byte("4\r\n"))
+	test.Equal("> 1> 2\n> 3\r\n> 4", buffer.String())
+}
+
+func TestWriter_WritesHeaderBeforeFirstLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithHeader([]byte("a,b\n")), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1,"))
+	test.Empty(buffer.String())
+
+	writer.Write([]byte("2\n3,4\n"))
+	test.Equal("a,b\n> 1,2\n> 3,4\n", buffer.String())
+
+	second := &bytes.Buffer{}
+
+	writer.SwapBackend(nopCloser{second})
+	test.Empty(second.String())
+
+	writer.Write([]byte("5,6\n"))
+	test.Equal("a,b\n> 5,6\n", second.String())
+	test.Equal("a,b\n> 1,2\n> 3,4\n", buffer.String())
+
+	writer = New(
+		nopCloser{&bytes.Buffer{}}, nil, false,
+		WithHeader([]byte("a,b\n")),
+	)
+	writer.Close()
+	test.Empty(writer.backend.(nopCloser).String())
+}
+
+func TestWriter_WritesPreambleOnceBeforeFirstData(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithPreamble([]byte("\xef\xbb\xbf")), WithHeader([]byte("a,b\n")),
+		WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1,"))
+	test.Empty(buffer.String())
+
+	writer.Write([]byte("2\n3,4\n"))
+	test.Equal("\xef\xbb\xbfa,b\n> 1,2\n> 3,4\n", buffer.String())
+
+	second := &bytes.Buffer{}
+	writer.SwapBackend(nopCloser{second})
+	writer.Write([]byte("5,6\n"))
+	test.Equal("a,b\n> 5,6\n", second.String())
+
+	writer = New(
+		nopCloser{&bytes.Buffer{}}, nil, false,
+		WithPreamble([]byte("\xef\xbb\xbf")),
+	)
+	writer.Close()
+	test.Empty(writer.backend.(nopCloser).String())
+}
+
+func TestWriter_WritesRestOfPreambleOnRetry(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+	writer := New(
+		backend, nil, false,
+		WithPreamble([]byte("\xef\xbb\xbf")),
+	)
+
+	_, err := writer.Write([]byte("1\n"))
+	test.Error(err)
+
+	backend.limit = 100
+	writer.Write([]byte("2\n"))
+	test.Equal("\xef\xbb\xbf2\n", backend.String())
+}
+
+func TestWriter_WritesTrailerOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, true, WithTrailer([]byte("end\n")))
+
+	writer.Write([]byte("1\n2"))
+	test.Equal("1\n", buffer.String())
+
+	writer.Close()
+	test.Equal("1\n2\nend\n", buffer.String())
+}
+
+func TestWriter_WritesEmptyMarkerIfNothingWritten(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, true,
+		WithEmptyMarker([]byte("(no output)\n")),
+		WithPreamble([]byte("P")),
+		WithHeader([]byte("H\n")),
+		WithTrailer([]byte("T\n")),
+		WithDiscardPartialOnClose(true),
+	)
+
+	writer.Write([]byte("1"))
+
+	test.NoError(writer.Close())
+	test.Equal("PH\n(no output)\nT\n", buffer.String())
+}
+
+func TestWriter_DoNotWriteEmptyMarkerIfAnythingWritten(t *testing.T) {
+	test := assert.New(t)
+
+	for _, data := range []string{"1\n", "1"} {
+		buffer := &bytes.Buffer{}
+		writer := New(
+			nopCloser{buffer}, nil, true,
+			WithEmptyMarker([]byte("(no output)\n")),
+			WithHeader([]byte("H\n")),
+		)
+
+		writer.Write([]byte(data))
+
+		test.NoError(writer.Close())
+		test.Equal("H\n1\n", buffer.String())
+	}
+}
+
+func TestWriter_DoNotWriteTrailerIfNothingWritten(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, true, WithTrailer([]byte("end\n")))
+
+	writer.Write(nil)
+	writer.Close()
+	test.Empty(buffer.String())
+}
+
+func TestWriter_PrependsPrefixToEveryCompleteLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, true, WithPrefix("> "))
+
+	writer.Write([]byte("1\n\n2"))
+	test.Equal("> 1\n> \n", buffer.String())
+
+	writer.Write([]byte("3\n4"))
+	test.Equal("> 1\n> \n> 23\n", buffer.String())
+
+	writer.Close()
+	test.Equal("> 1\n> \n> 23\n> 4\n", buffer.String())
+}
+
+func TestWriter_PrependsTimestampOfWritingToEveryLine(t *testing.T) {
+	test := assert.New(t)
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithTimestamp(""), WithPrefix("> "),
+		WithClock(func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}),
+	)
+
+	writer.Write([]byte("1\n2"))
+	test.Equal("2024-01-02T15:04:06Z > 1\n", buffer.String())
+
+	writer.Write([]byte("3\n4"))
+	test.Equal(
+		"2024-01-02T15:04:06Z > 1\n2024-01-02T15:04:07Z > 23\n",
+		buffer.String(),
+	)
+
+	writer = New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithTimestamp(time.Kitchen),
+		WithClock(func() time.Time {
+			return now
+		}),
+	)
+
+	buffer.Reset()
+	writer.Write([]byte("5\n"))
+	test.Equal("3:04PM 5\n", buffer.String())
+}
+
+func TestWriter_DoNotPrependPrefixToContinuationOfFlushedLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, false, WithPrefix("> "))
+
+	writer.Write([]byte("1"))
+	writer.Flush()
+	test.Equal("> 1", buffer.String())
+
+	writer.Write([]byte("2\n3\n"))
+	test.Equal("> 12\n> 3\n", buffer.String())
+}
+
+func TestWriter_ReturnsBytesOfDataWrittenToBackendOnErrorWithPrefix(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 7}
+	writer := New(backend, &sync.Mutex{}, false, WithPrefix("> "))
+
+	written, err := writer.Write([]byte("1\n23\n"))
+	test.Error(err)
+	test.Equal(3, written)
+	test.Equal("> 1\n> 2", backend.String())
+}
+
+func TestWriter_PassesEveryCompleteLineThroughLineFunc(t *testing.T) {
+	test := assert.New(t)
+
+	var lines []string
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithLineFunc(func(line []byte) []byte {
+			lines = append(lines, string(line))
+
+			return bytes.ReplaceAll(line, []byte("secret"), []byte("***"))
+		}),
+	)
+
+	writer.Write([]byte("1 secret\n2"))
+	test.Equal("1 ***\n", buffer.String())
+
+	writer.Write([]byte(" secret\n3"))
+	test.Equal("1 ***\n2 ***\n", buffer.String())
+
+	writer.Close()
+	test.Equal("1 ***\n2 ***\n3\n", buffer.String())
+	test.Equal([]string{"1 secret\n", "2 secret\n", "3\n"}, lines)
+}
+
+func TestWriter_ProcessesRemainingLineOnCloseLikeOtherLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithPrefix("> "), WithLineNumbers(1), WithLineFunc(bytes.ToUpper),
+	)
+
+	writer.Write([]byte("a\nb"))
+	writer.Close()
+	test.Equal(">    1: A\n>    2: B\n", buffer.String())
+}
+
+func TestWriter_DropsLineIfLineFuncReturnsEmptySlice(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithPrefix("> "),
+		WithLineFunc(func(line []byte) []byte {
+			if bytes.HasPrefix(line, []byte("#")) {
+				return nil
+			}
+
+			return line
+		}),
+	)
+
+	writer.Write([]byte("1\n# 2\n3\n"))
+	test.Equal("> 1\n> 3\n", buffer.String())
+}
+
+func TestWriter_CollapsesConsecutiveBlankLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithCollapseBlankLines(), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\n\n\n2\n\n"))
+	writer.Write([]byte("\n3"))
+	writer.Flush()
+	writer.Write([]byte("\n\n"))
+	test.Equal("> 1\n> \n> 2\n> \n> 3\n> \n", buffer.String())
+}
+
+func TestWriter_FlushesIncompleteLineIfItReachesMaxBufferSize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithMaxBufferBytes(3),
+	)
+
+	writer.Write([]byte("1\n23"))
+	test.Equal("1\n", buffer.String())
+
+	writer.Write([]byte("45"))
+	test.Equal("1\n2345", buffer.String())
+	test.Equal(0, writer.Buffered())
+
+	writer.Write([]byte("6\n"))
+	test.Equal("1\n23456\n", buffer.String())
+}
+
+func TestWriter_TerminatesWrittenIncompleteLineOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithMaxBufferBytes(2),
+	)
+
+	writer.Write([]byte("1\n23"))
+	test.Equal("1\n23", buffer.String())
+	test.Equal(0, writer.Buffered())
+
+	test.NoError(writer.Close())
+	test.Equal("1\n23\n", buffer.String())
+}
+
+func TestWriter_TruncatesOutputAtMaxTotalSize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithMaxTotalBytes(5))
+
+	written, err := writer.Write([]byte("12\n3"))
+	test.NoError(err)
+	test.Equal(4, written)
+
+	written, err = writer.Write([]byte("4\n56\n"))
+	test.True(errors.Is(err, ErrOutputLimitExceeded))
+	test.Equal(1, written)
+	test.Equal("12\n34", buffer.String())
+
+	written, err = writer.WriteString("7\n")
+	test.True(errors.Is(err, ErrOutputLimitExceeded))
+	test.Equal(0, written)
+	test.Equal("12\n34", buffer.String())
+}
+
+func TestWriter_StartsEveryWriteFromNewLineIfForced(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithForceLinePerWrite())
+
+	writer.Write([]byte("1\n2"))
+	writer.Write([]byte("3\n"))
+	writer.Write([]byte("4\n"))
+	writer.WriteString("5")
+	writer.Flush()
+	writer.Write(nil)
+	writer.Write([]byte("6"))
+	test.Equal("1\n2\n3\n4\n5\n", buffer.String())
+
+	writer.Close()
+	test.Equal("1\n2\n3\n4\n5\n6", buffer.String())
+}
+
+func TestWriter_TreatsConsecutiveBytesAsSingleWriteIfForced(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithForceLinePerWrite())
+
+	writer.Write([]byte("1"))
+	writer.WriteByte('c')
+	writer.WriteByte('d')
+	writer.Write([]byte("2"))
+	writer.WriteByte('e')
+	writer.Close()
+
+	test.Equal("1\ncd\n2\ne", buffer.String())
+}
+
+func TestWriter_WritesIncompleteLineUpToSoftDelimiter(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, false,
+		WithSoftFlushDelimiter([]byte(". ")), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("a. b."))
+	test.Equal("> a. ", buffer.String())
+
+	writer.Write([]byte(" c\nd. e"))
+	test.Equal("> a. b. c\n> d. ", buffer.String())
+
+	writer.Write([]byte("\n"))
+	test.Equal("> a. b. c\n> d. e\n", buffer.String())
+
+	lines, _ := writer.Stats()
+	test.EqualValues(2, lines)
+}
+
+func TestWriter_DiscardsIncompleteLineOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithDiscardPartialOnClose(true),
+	)
+
+	writer.Write([]byte("1\n2"))
+	test.NoError(writer.Close())
+	test.Equal("1\n", buffer.String())
+}
+
+func TestWriter_ClosesBackendOnlyOnce(t *testing.T) {
+	test := assert.New(t)
+
+	counter := &writeCounter{}
+
+	writer := New(counter, &sync.Mutex{}, true)
+	writer.Write([]byte("1"))
+
+	test.NoError(writer.Close())
+	test.NoError(writer.Close())
+	test.Equal(1, counter.count)
+	test.Equal(1, counter.closes)
+}
+
+type closeFailer struct {
+	*bytes.Buffer
+}
+
+func (closer closeFailer) Close() error {
+	return errors.New("close error")
+}
+
+func TestWriter_ReturnsBackendCloseErrorAfterSuccessfulFlush(t *testing.T) {
+	test := assert.New(t)
+
+	backend := closeFailer{&bytes.Buffer{}}
+	writer := New(backend, &sync.Mutex{}, false)
+
+	writer.Write([]byte("1"))
+
+	err := writer.Close()
+	test.True(errors.Is(err, ErrCloseBackend))
+	test.False(errors.Is(err, ErrFlush))
+	test.EqualError(
+		err,
+		"lineflushwriter: unable to close backend: close error",
+	)
+	test.Equal("1", backend.String())
+}
+
+func TestWriter_ClosesBackendEvenIfFlushFails(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 0}
+	writer := New(backend, &sync.Mutex{}, false)
+
+	writer.Write([]byte("1"))
+
+	err := writer.Close()
+	test.True(backend.closed)
+	test.True(errors.Is(err, ErrFlush))
+	test.False(errors.Is(err, ErrCloseBackend))
+	test.EqualError(
+		err,
+		"lineflushwriter: unable to flush remaining data: "+
+			"flush line 1 (offset 0): limit reached",
+	)
+}
+
+func TestWriter_DoNotCloseBackendIfRequested(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	writer := New(backend, &sync.Mutex{}, true, WithoutBackendClose())
+
+	writer.Write([]byte("1\n2"))
+
+	test.NoError(writer.Close())
+	test.False(backend.closed)
+	test.Equal("1\n2\n", backend.String())
+
+	writer = New(backend, &sync.Mutex{}, true, WithoutBackendClose())
+
+	test.NoError(writer.Abort())
+	test.False(backend.closed)
+}
+
+func TestWriter_CallsCloseHookAfterBackendIsClosed(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		calls   int
+		flushed int
+		closed  bool
+		writer  *Writer
+	)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 10}
+	writer = New(
+		backend, &sync.Mutex{}, true,
+		WithCloseHook(func(size int, err error) {
+			calls++
+			flushed = size
+			closed = backend.closed
+
+			test.NoError(err)
+			test.Equal(ErrClosed, writer.Flush())
+		}),
+	)
+
+	writer.Write([]byte("1\n23"))
+	writer.Close()
+	writer.Close()
+
+	test.Equal(1, calls)
+	test.Equal(3, flushed)
+	test.True(closed)
+}
+
+func TestWriter_ReleasesMutexIfCloseIsInterruptedByPanic(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithLineFunc(func(line []byte) []byte {
+			panic("line func")
+		}),
+	)
+
+	writer.Write([]byte("1"))
+
+	test.Panics(func() {
+		writer.Close()
+	})
+
+	test.True(writer.Closed())
+	test.NoError(writer.Close())
+}
+
+func TestWriter_CallsPartialHookWithIncompleteLineOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	var partials []string
+
+	hook := WithPartialAtCloseHook(func(partial []byte) {
+		partials = append(partials, string(partial))
+	})
+
+	for _, data := range []string{"", "1\r\n", "1\r\n23", "1\r\n2\r"} {
+		buffer := &bytes.Buffer{}
+		writer := New(nopCloser{buffer}, nil, false, WithCRLF(), hook)
+
+		writer.Write([]byte(data))
+		writer.Close()
+		test.Equal(data, buffer.String())
+	}
+
+	test.Equal([]string{"23", "2\r"}, partials)
+}
+
+func TestWriter_ReportsAmountOfBytesFlushedOnClose(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 4}
+	writer := New(backend, &sync.Mutex{}, true)
+
+	writer.Write([]byte("1\n2345"))
+
+	flushed, err := writer.CloseWithReport()
+	test.True(errors.Is(err, ErrFlush))
+	test.Equal(2, flushed)
+	test.Equal("1\n23", backend.String())
+	test.True(backend.closed)
+
+	flushed, err = writer.CloseWithReport()
+	test.NoError(err)
+	test.Equal(0, flushed)
+}
+
+func TestWriter_ReportsWhetherItIsClosed(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, nil, false)
+	test.False(writer.Closed())
+
+	writer.Close()
+	test.True(writer.Closed())
+
+	writer.Reset(nopCloser{&bytes.Buffer{}})
+	test.False(writer.Closed())
+}
+
+func TestWriter_ReturnsBackendErrorAfterFailureIfSticky(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+	writer := New(backend, nil, true, WithStickyError())
+
+	_, err := writer.Write([]byte("1\n2\n3"))
+	test.EqualError(err, "flush line 2 (offset 2): limit reached")
+
+	written, err := writer.Write([]byte("4\n"))
+	test.EqualError(err, "flush line 2 (offset 2): limit reached")
+	test.Equal(0, written)
+	test.Zero(writer.Buffered())
+
+	test.EqualError(writer.Flush(), "flush line 2 (offset 2): limit reached")
+
+	err = writer.Close()
+	test.True(errors.Is(err, ErrFlush))
+	test.True(backend.closed)
+	test.Equal("1\n", backend.String())
+}
+
+func TestWriter_WritesIntoNewBackendAfterStickyFailure(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+	writer := New(backend, nil, true, WithStickyError(), WithRetainOnError())
+
+	writer.Write([]byte("1\n2\n3"))
+
+	_, err := writer.Write([]byte("4\n"))
+	test.EqualError(err, "flush line 2 (offset 2): limit reached")
+
+	buffer := &bytes.Buffer{}
+
+	_, err = writer.SwapBackend(nopCloser{buffer})
+	test.NoError(err)
+
+	_, err = writer.Write([]byte("4\n"))
+	test.NoError(err)
+	test.Equal("1\n", backend.String())
+	test.Equal("2\n34\n", buffer.String())
+}
+
+func TestWriter_ReturnsErrorOnWriteAfterClose(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+	writer.Close()
+
+	written, err := writer.Write([]byte("1\n"))
+	test.Equal(ErrClosed, err)
+	test.Equal(0, written)
+
+	_, err = writer.WriteString("1\n")
+	test.Equal(ErrClosed, err)
+
+	test.Equal(ErrClosed, writer.Flush())
+	test.Equal(0, writer.Buffered())
+}
+
+func TestWriter_CountsLinesAndBytesWrittenToBackend(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, true)
+
+	writer.Write([]byte("1\n23\n4"))
+	writer.Flush()
+	writer.Write([]byte("5\n6"))
+	writer.Close()
+
+	lines, bytes := writer.Stats()
+	test.Equal(uint64(4), lines)
+	test.Equal(uint64(10), bytes)
+}
+
+func TestWriter_WritesLinesByteByByte(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false)
+
+	var _ io.ByteWriter = writer
+
+	for _, char := range []byte("12\n3") {
+		test.NoError(writer.WriteByte(char))
+	}
+
+	test.Equal("12\n", buffer.String())
+	test.Equal(1, writer.Buffered())
+
+	writer.Close()
+	test.True(errors.Is(writer.WriteByte('\n'), ErrClosed))
+}
+
+func TestWriter_ReturnsStatsWithoutWaitingForWrites(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &blockingWriter{
+		Buffer:  &bytes.Buffer{},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	writer := New(backend, nil, false)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		writer.Write([]byte("1\n"))
+	}()
+
+	<-backend.started
+
+	lines, _ := writer.Stats()
+	test.EqualValues(0, lines)
+
+	close(backend.release)
+	<-done
+
+	lines, _ = writer.Stats()
+	test.EqualValues(1, lines)
+}
+
+func TestWriter_ReturnsAmountOfLinesWrittenByCall(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, nil, false)
+
+	written, lines, err := writer.WriteLines([]byte("1\n2\n3"))
+	test.NoError(err)
+	test.Equal(5, written)
+	test.Equal(2, lines)
+
+	written, lines, err = writer.WriteLines([]byte("4"))
+	test.NoError(err)
+	test.Equal(1, written)
+	test.Equal(0, lines)
+
+	written, lines, err = writer.WriteLines([]byte("\n"))
+	test.NoError(err)
+	test.Equal(1, written)
+	test.Equal(1, lines)
+}
+
+func TestWriter_CountsLinesAndBytesWrittenToBackendWithPrefix(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\n23\n4"))
+
+	lines, bytes := writer.Stats()
+	test.Equal(uint64(2), lines)
+	test.Equal(uint64(9), bytes)
+}
+
+func TestWriter_ReturnsFileDescriptorOfBackend(t *testing.T) {
+	test := assert.New(t)
+
+	file, err := os.CreateTemp(t.TempDir(), "")
+	test.NoError(err)
+
+	defer file.Close()
+
+	writer := New(file, nil, false)
+	test.Equal(file.Fd(), writer.Fd())
+
+	writer = New(nopCloser{&bytes.Buffer{}}, nil, false)
+	test.Equal(^uintptr(0), writer.Fd())
+}
+
+type deadlineWriter struct {
+	*bytes.Buffer
+	deadlines []time.Time
+}
+
+func (writer *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	writer.deadlines = append(writer.deadlines, deadline)
+	return nil
+}
+
+func TestWriter_SetsWriteDeadlineToBackendBeforeEveryWrite(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		deadline = time.Now().Add(time.Minute)
+		backend  = &deadlineWriter{Buffer: &bytes.Buffer{}}
+		writer   = NewFromWriter(backend, nil, false)
+	)
+
+	writer.Write([]byte("1\n"))
+	test.Empty(backend.deadlines)
+
+	test.NoError(writer.SetWriteDeadline(deadline))
+
+	writer.Write([]byte("2"))
+	test.Empty(backend.deadlines)
+
+	writer.Write([]byte("\n"))
+	writer.Flush()
+	test.Equal([]time.Time{deadline}, backend.deadlines)
+
+	writer = New(nopCloser{&bytes.Buffer{}}, nil, false)
+	test.True(errors.Is(writer.SetWriteDeadline(deadline), os.ErrNoDeadline))
+}
+
+func TestWriter_ObservesEveryLineWrittenToBackend(t *testing.T) {
+	test := assert.New(t)
+
+	var sizes []int
+
+	observe := WithFlushObserver(func(size int) {
+		sizes = append(sizes, size)
+	})
+
+	writer := New(nopCloser{&bytes.Buffer{}}, nil, false, observe)
+	writer.Write([]byte("1\n23\n4"))
+	writer.Flush()
+	writer.Write([]byte("5\n"))
+	test.Equal([]int{2, 3, 2}, sizes)
+
+	sizes = nil
+
+	writer = New(
+		nopCloser{&bytes.Buffer{}}, nil, false,
+		observe, WithPrefix("> "),
+	)
+	writer.Write([]byte("1\n23\n4"))
+	writer.Flush()
+	writer.Write([]byte("5\n"))
+	test.Equal([]int{4, 5, 2}, sizes)
+}
+
+func TestWriter_ReturnsCopyOfConfiguration(t *testing.T) {
+	test := assert.New(t)
+
+	writer := NewWithDelimiter(
+		nopCloser{&bytes.Buffer{}}, nil, true, ';',
+		WithPrefix("> "), WithMaxBufferBytes(10),
+	)
+
+	test.Equal(';', writer.Delimiter())
+	test.True(writer.EnsuresNewline())
+
+	config := writer.Config()
+	test.Equal(Config{
+		Delimiter:      []byte(";"),
+		EnsureNewline:  true,
+		Prefix:         "> ",
+		MaxBufferBytes: 10,
+	}, config)
+
+	config.Delimiter[0] = '\n'
+	test.Equal([]byte(";"), writer.Config().Delimiter)
+
+	writer = New(nopCloser{&bytes.Buffer{}}, nil, false, WithCRLF())
+	test.Equal(utf8.RuneError, writer.Delimiter())
+	test.Equal([]byte("\r\n"), writer.Config().Delimiter)
+}
+
+func TestWriter_ReturnsCopyOfOptions(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, nil, false,
+		WithCRLF(), WithHeader([]byte("#\n")), WithBatchBytes(1024),
+		WithRateLimit(10, RateLimitDrop), WithUnsynchronized(),
+	)
+
+	test.Equal(Options{
+		Config: Config{
+			Delimiter: []byte("\r\n"),
+		},
+		Header:         []byte("#\n"),
+		BatchBytes:     1024,
+		RateLimit:      10,
+		RateLimitMode:  RateLimitDrop,
+		Unsynchronized: true,
+	}, writer.Options())
+
+	test.Equal(Options{
+		Config: Config{
+			Delimiter:     []byte("\n"),
+			EnsureNewline: true,
+		},
+	}, New(nopCloser{&bytes.Buffer{}}, nil, true).Options())
+}
+
+func TestWriter_DescribesStateWithoutBufferedData(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, true)
+	writer.Write([]byte("1\nsecret"))
+
+	test.Equal(
+		`lineflushwriter{buffered: 6 bytes, closed: false, delimiter: "\n", `+
+			`ensure newline: true}`,
+		fmt.Sprint(writer),
+	)
+
+	writer.Close()
+
+	test.Equal(
+		`lineflushwriter{buffered: 0 bytes, closed: true, delimiter: "\n", `+
+			`ensure newline: true}`,
+		writer.String(),
+	)
+}
+
+func TestWriter_ReturnsBufferedDataOnDetach(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	writer := New(backend, nil, true)
+
+	writer.Write([]byte("1\n2"))
+	test.Equal([]byte("2"), writer.Detach())
+	test.Equal("1\n", backend.String())
+	test.False(backend.closed)
+
+	_, err := writer.Write([]byte("3\n"))
+	test.True(errors.Is(err, ErrClosed))
+	test.Nil(writer.Detach())
+
+	test.NoError(writer.Close())
+	test.False(backend.closed)
+}
+
+func TestWriter_UsesLockSpecifiedBySetLock(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false)
+
+	writer.Write([]byte("1"))
+
+	lock := &sync.Mutex{}
+	writer.SetLock(lock)
+	test.Equal("", buffer.String())
+
+	lock.Lock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		writer.Write([]byte("\n"))
+	}()
+
+	select {
+	case <-done:
+		test.Fail("write should wait for new lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lock.Unlock()
+	<-done
+
+	test.Equal("1\n", buffer.String())
+}
+
+func TestWriter_UsesFreshLockIfSetLockIsCalledWithNil(t *testing.T) {
+	test := assert.New(t)
+
+	lock := &sync.Mutex{}
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, lock, false)
+
+	writer.BeginGroup()
+	writer.SetLock(nil)
+
+	// Group is ended, so old lock is free.
+	lock.Lock()
+	writer.Write([]byte("1\n"))
+	lock.Unlock()
+
+	test.Equal("1\n", buffer.String())
+}
+
+func TestWriter_KeepsIncompleteLineOnSwapBackend(t *testing.T) {
+	test := assert.New(t)
+
+	first := &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+	second := &bytes.Buffer{}
+
+	writer := New(first, nil, false, WithPrefix("> "), WithRetainOnError())
+
+	writer.Write([]byte("1\n2"))
+	writer.Flush()
+	writer.Write([]byte("3"))
+
+	old, err := writer.SwapBackend(nopCloser{second})
+	test.NoError(err)
+	test.Equal(first, old)
+	test.False(first.closed)
+
+	writer.Write([]byte("\n4"))
+	test.Equal("> 1\n> 2", first.String())
+	test.Equal("> 3\n", second.String())
+}
+
+func TestWriter_DoNotSwapBackendIfCompleteLinesAreNotWritten(t *testing.T) {
+	test := assert.New(t)
+
+	first := &limitWriter{Buffer: &bytes.Buffer{}, limit: 2}
+
+	writer := New(first, nil, false, WithRetainOnError())
+
+	writer.Write([]byte("12\n"))
+
+	old, err := writer.SwapBackend(nopCloser{&bytes.Buffer{}})
+	test.EqualError(err, "flush line 1 (offset 0): limit reached")
+	test.Nil(old)
+
+	writer.Write([]byte("3\n"))
+	test.Equal("12", first.String())
+}
+
+func TestWriter_ClosesBackendWithoutWritingBufferedDataOnAbort(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		backend = &limitWriter{Buffer: &bytes.Buffer{}, limit: 100}
+		hooked  = false
+	)
+
+	writer := New(
+		backend, &sync.Mutex{}, true,
+		WithCloseHook(func(int, error) {
+			hooked = true
+		}),
+	)
+
+	writer.Write([]byte("1\n23"))
+
+	test.NoError(writer.Abort())
+	test.Equal("1\n", backend.String())
+	test.True(backend.closed)
+	test.True(writer.Closed())
+	test.Zero(writer.Buffered())
+	test.False(hooked)
+
+	_, err := writer.Write([]byte("4\n"))
+	test.Equal(ErrClosed, err)
+
+	backend.closed = false
+	test.NoError(writer.Abort())
+	test.NoError(writer.Close())
+	test.False(backend.closed)
+}
+
+func TestWriter_DiscardsBufferedDataOnReset(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, &sync.Mutex{}, true, WithPrefix("> "))
+
+	writer.Write([]byte("1\n2"))
+	writer.Flush()
+	writer.Write([]byte("3"))
+
+	reset := &bytes.Buffer{}
+	writer.Reset(nopCloser{reset})
+
+	writer.Write([]byte("4\n5"))
+	writer.Close()
+
+	test.Equal("> 1\n> 2", buffer.String())
+	test.Equal("> 4\n> 5\n", reset.String())
+}
+
+func TestWriter_CanBeWrittenAfterResetOfClosedWriter(t *testing.T) {
+	test := assert.New(t)
+
+	writer := New(nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false)
+	writer.Close()
+
+	buffer := &bytes.Buffer{}
+	writer.Reset(nopCloser{buffer})
+
+	_, err := writer.Write([]byte("1\n"))
+	test.NoError(err)
+	test.Equal("1\n", buffer.String())
+}
+
+func TestWriter_PrependsLineNumberToEveryLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithLineNumbers(9998),
+		WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\n2"))
+	writer.Flush()
+	writer.Write([]byte("3\n\n4"))
+	writer.Close()
+
+	test.Equal(
+		"> 9998: 1\n> 9999: 23\n> 10000: \n> 10001: 4\n",
+		buffer.String(),
+	)
+}
+
+func TestWriter_AlignsLineNumbers(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithLineNumbers(1),
+	)
+
+	writer.Write([]byte("1\n2\n"))
+	test.Equal("   1: 1\n   2: 2\n", buffer.String())
+}
+
+func TestWriter_GrowsLineNumberWidthToWidestNumber(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithLineNumbers(9999),
+	)
+
+	writer.Write([]byte("a\nb\nc\n"))
+	test.Equal("9999: a\n10000: b\n10001: c\n", buffer.String())
+
+	buffer.Reset()
+	writer = New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithLineNumbers(-10000),
+	)
+
+	writer.Write([]byte("a\nb\n"))
+	test.Equal("-10000: a\n -9999: b\n", buffer.String())
+}
+
+func TestWriter_WritesLinesByChunksOfSpecifiedSize(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &chunkRecorder{}
+	writer := NewFromWriter(backend, nil, false, WithSizeOrLineFlush(6))
+
+	writer.Write([]byte("1\n22\n333\n4444\n5"))
+	test.Equal([]string{"1\n22\n", "333\n", "4444\n"}, backend.chunks)
+
+	writer.Write([]byte("\n"))
+	test.Equal(
+		[]string{"1\n22\n", "333\n", "4444\n", "5\n"},
+		backend.chunks,
+	)
+}
+
+func TestWriter_SplitsLinesLongerThanChunkSize(t *testing.T) {
+	test := assert.New(t)
+
+	backend := &chunkRecorder{}
+	writer := NewFromWriter(
+		backend, nil, true,
+		WithSizeOrLineFlush(4), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("123"))
+	test.Empty(backend.chunks)
+
+	writer.Write([]byte("4567890\n1\n2"))
+	test.Equal(
+		[]string{"> 1234", "5678", "90\n", "> 1\n"},
+		backend.chunks,
+	)
+
+	test.NoError(writer.Close())
+	test.Equal(
+		[]string{"> 1234", "5678", "90\n", "> 1\n", "> 2\n"},
+		backend.chunks,
+	)
+}
+
+func TestWriter_WritesLinesInBatchesOfSpecifiedSize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, nil, true,
+		WithBatchBytes(6), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\n2\n"))
+	writer.Write([]byte("3"))
+	test.Empty(buffer.String())
+
+	writer.Write([]byte("\n4"))
+	test.Equal("> 1\n> 2\n> 3\n", buffer.String())
+
+	writer.Write([]byte("\n5\n"))
+	test.False(writer.PendingPartial())
+	test.Equal("> 1\n> 2\n> 3\n", buffer.String())
+
+	writer.Write([]byte("6"))
+	writer.Close()
+	test.Equal("> 1\n> 2\n> 3\n> 4\n> 5\n> 6\n", buffer.String())
+}
+
+func TestWriter_ProcessesBatchWrittenOnCloseLikeOtherLines(t *testing.T) {
+	test := assert.New(t)
+
+	for _, ensureNewline := range []bool{false, true} {
+		backend := &chunkRecorder{}
+		writer := NewFromWriter(
+			backend, nil, ensureNewline,
+			WithBatchBytes(100), WithPrefix("> "),
+			WithLineFunc(bytes.ToUpper),
+		)
+
+		writer.Write([]byte("a\nb\n"))
+		writer.Write([]byte("c"))
+		test.Empty(backend.chunks)
+
+		test.NoError(writer.Close())
+
+		expected := "> A\n> B\n> C"
+		if ensureNewline {
+			expected += "\n"
+		}
+
+		test.Equal([]string{expected}, backend.chunks)
+	}
+}
+
+func TestWriter_CutsLinesExceedingMaxLineSize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithMaxLineBytes(3),
+	)
+
+	writer.Write([]byte("123\n1234567\n12"))
+	test.Equal("123\n123\n456\n7\n", buffer.String())
+	test.Equal(2, writer.Buffered())
+
+	writer.Write([]byte("3"))
+	test.Equal("123\n123\n456\n7\n", buffer.String())
+
+	writer.Write([]byte("4567"))
+	test.Equal("123\n123\n456\n7\n123\n456", buffer.String())
+	test.Equal(1, writer.Buffered())
+
+	writer.Write([]byte("\n"))
+	test.Equal("123\n123\n456\n7\n123\n456\n7\n", buffer.String())
+
+	lines, _ := writer.Stats()
+	test.Equal(uint64(7), lines)
+}
+
+func TestWriter_DoNotCutLineOfMaxLineSizeTerminatedByNextWrite(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithMaxLineBytes(3),
+	)
+
+	writer.Write([]byte("123"))
+	writer.Write([]byte("\n"))
+	test.Equal("123\n", buffer.String())
+}
+
+func TestWriter_DoNotCutWrittenLineOfMaxLineSizeTerminatedByNextWrite(
+	t *testing.T,
+) {
+	test := assert.New(t)
+
+	testcases := []struct {
+		options []Option
+		writes  []string
+		output  string
+	}{
+		{
+			[]Option{WithMaxBufferBytes(3)},
+			[]string{"abc", "\nd"},
+			"abc\nd",
+		},
+		{
+			[]Option{WithCRLF()},
+			[]string{"abc\r", "\nx\r\n"},
+			"abc\r\nx\r\n",
+		},
+	}
+
+	for _, testcase := range testcases {
+		buffer := &bytes.Buffer{}
+		writer := New(
+			nopCloser{buffer}, &sync.Mutex{}, false,
+			append(testcase.options, WithMaxLineBytes(3))...,
+		)
+
+		for _, data := range testcase.writes {
+			writer.Write([]byte(data))
+		}
+
+		test.NoError(writer.Close())
+		test.Equal(testcase.output, buffer.String())
+	}
+}
+
+func TestWriter_CountsFlushedIncompleteLineTowardsMaxLineSize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithMaxLineBytes(3),
+		WithMaxBufferBytes(2),
+		WithPrefix("> "),
+	)
+
+	writer.Write([]byte("12"))
+	test.Equal("> 12", buffer.String())
+
+	writer.Write([]byte("34\n"))
+	test.Equal("> 123\n> 4\n", buffer.String())
+}
+
+func TestWriter_WritesIntoTeeSameDataAsIntoBackend(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	tee := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithPrefix("> "),
+		WithTee(tee, false),
+	)
+
+	writer.Write([]byte("1\n2"))
+	writer.Close()
+
+	test.Equal("> 1\n> 2\n", buffer.String())
+	test.Equal(buffer.String(), tee.String())
+}
+
+func TestWriter_RoutesCompleteLinesIntoAdditionalWriter(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		buffer = &bytes.Buffer{}
+		stderr = &bytes.Buffer{}
+		routed []string
+	)
+
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithPrefix("> "),
+		WithLineRouter(func(line []byte) io.Writer {
+			routed = append(routed, string(line))
+
+			if bytes.HasPrefix(line, []byte("ERROR ")) {
+				return stderr
+			}
+
+			return nil
+		}),
+	)
+
+	writer.Write([]byte("INFO 1\nERROR 2\nERR"))
+	writer.Write([]byte("OR 3\nINFO 4"))
+	test.Equal("> INFO 1\n> ERROR 2\n> ERROR 3\n", buffer.String())
+	test.Equal("> ERROR 2\n> ERROR 3\n", stderr.String())
+	test.Equal([]string{"INFO 1\n", "ERROR 2\n", "ERROR 3\n"}, routed)
+
+	writer.Close()
+	test.Equal("INFO 4\n", routed[3])
+}
+
+func TestWriter_PropagatesTeeErrorsOnlyIfRequested(t *testing.T) {
+	test := assert.New(t)
+
+	tee := &limitWriter{Buffer: &bytes.Buffer{}, limit: 0}
+
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithTee(tee, false),
+	)
+
+	written, err := writer.Write([]byte("1\n"))
+	test.NoError(err)
+	test.Equal(2, written)
+
+	writer = New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithTee(tee, true),
+	)
+
+	written, err = writer.Write([]byte("1\n"))
+	test.EqualError(err, "flush line 2 (offset 2): limit reached")
+	test.Equal(2, written)
+}
+
+func TestWriter_ShrinksBufferAfterWritingLargeLine(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(nopCloser{buffer}, nil, false, WithShrinkThreshold(1024))
+
+	writer.Write(bytes.Repeat([]byte("1"), 10000))
+	test.GreaterOrEqual(cap(writer.buffer), 10000)
+
+	writer.Write([]byte("\n23"))
+	test.LessOrEqual(cap(writer.buffer), 1024)
+	test.Equal([]byte("23"), writer.Peek())
+	test.Equal(10001, buffer.Len())
+}
+
+func TestWriter_BuffersDataIntoSpecifiedBuffer(t *testing.T) {
+	test := assert.New(t)
+
+	memory := make([]byte, 4, 16)
+
+	writer := New(
+		nopCloser{&bytes.Buffer{}}, &sync.Mutex{}, false,
+		WithBuffer(memory),
+	)
+
+	test.Equal(0, writer.Buffered())
+
+	writer.Write([]byte("1\n23"))
+	test.Equal("23", string(memory[:2]))
+
+	writer.Reset(nopCloser{&bytes.Buffer{}})
+	writer.Write([]byte("45"))
+	test.Equal("45", string(memory[:2]))
+	test.Equal(16, cap(writer.buffer))
+}
+
+func TestWriter_DoNotAllocateForLinesSmallerThanScratchSize(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		data   = []byte("line\n")
+		writer = New(
+			&writeCounter{}, nil, false,
+			WithPrefix("> "), WithScratchSize(64),
+		)
+	)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		writer.Write(data)
+	})
+
+	test.Zero(allocs)
+}
+
+func TestWriter_AllocatesBufferOfInitialCapacity(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithInitialCapacity(4096),
+	)
+
+	test.Equal(4096, cap(writer.buffer))
+
+	writer.Write(bytes.Repeat([]byte("x"), 4000))
+	test.Equal(4096, cap(writer.buffer))
+
+	writer.Write([]byte("\n"))
+	test.Equal(4001, buffer.Len())
+}
+
 func testWriterClose(
 	t *testing.T,
 	writer io.WriteCloser,
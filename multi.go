@@ -0,0 +1,56 @@
+package lineflushwriter
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// NewMulti returns new Writer, that works exactly like one returned by New,
+// but writes every line into all given backends in order. Every backend
+// receives data even if some of preceding backends failed, errors of all
+// backends are joined. Close closes all backends.
+func NewMulti(
+	lock sync.Locker,
+	ensureNewline bool,
+	backends ...io.WriteCloser,
+) *Writer {
+	return New(multiBackend(backends), lock, ensureNewline)
+}
+
+// multiBackend writes data into all backends.
+type multiBackend []io.WriteCloser
+
+// Write writes data into every backend and returns the least amount of bytes
+// written into backends.
+func (backends multiBackend) Write(data []byte) (int, error) {
+	var (
+		written = len(data)
+		errs    []error
+	)
+
+	for _, backend := range backends {
+		size, err := backend.Write(data)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		written = min(written, size)
+	}
+
+	return written, errors.Join(errs...)
+}
+
+// Close closes every backend.
+func (backends multiBackend) Close() error {
+	var errs []error
+
+	for _, backend := range backends {
+		err := backend.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMulti_WritesLinesIntoAllBackends(t *testing.T) {
+	test := assert.New(t)
+
+	first := &bytes.Buffer{}
+	second := &bytes.Buffer{}
+
+	writer := NewMulti(&sync.Mutex{}, true, nopCloser{first}, nopCloser{second})
+
+	writer.Write([]byte("1\n2"))
+	test.Equal("1\n", first.String())
+	test.Equal("1\n", second.String())
+
+	writer.Close()
+	test.Equal("1\n2\n", first.String())
+	test.Equal("1\n2\n", second.String())
+}
+
+func TestNewMulti_WritesIntoRemainingBackendsIfOneFails(t *testing.T) {
+	test := assert.New(t)
+
+	failing := &limitWriter{Buffer: &bytes.Buffer{}, limit: 1}
+	buffer := &bytes.Buffer{}
+	counter := &writeCounter{}
+
+	writer := NewMulti(
+		&sync.Mutex{}, false,
+		failing, nopCloser{buffer}, counter,
+	)
+
+	written, err := writer.Write([]byte("12\n"))
+	test.EqualError(err, "flush line 1 (offset 1): limit reached")
+	test.Equal(1, written)
+	test.Equal("12\n", buffer.String())
+
+	test.NoError(writer.Close())
+	test.True(failing.closed)
+	test.Equal(1, counter.closes)
+}
@@ -0,0 +1,582 @@
+package lineflushwriter
+
+import (
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Option configures optional Writer behavior and can be passed to
+// constructors.
+type Option func(*Writer)
+
+// WithLock makes Writer to use given lock to guarantee thread-safety. Writers
+// sharing the same lock and backend will not interleave lines of each other.
+func WithLock(lock sync.Locker) Option {
+	return func(writer *Writer) {
+		writer.lock = lock
+	}
+}
+
+// WithEnsureNewline makes Writer to ensure, that last line of output ends with
+// line delimiter.
+func WithEnsureNewline(ensureNewline bool) Option {
+	return func(writer *Writer) {
+		writer.ensureNewline = ensureNewline
+	}
+}
+
+// WithEnsureNewlineAlways makes Writer to ensure, that output, if it's not
+// empty, ends with exactly one line delimiter, so:
+//
+//   - nothing is written if nothing was written into Writer;
+//   - incomplete last line is terminated with delimiter on Close, even if
+//     it was already written into backend, e.g. by Flush;
+//   - trailing blank lines are kept in the buffer until non-blank data is
+//     written and are dropped on Close, so output, which consists of blank
+//     lines only, becomes single delimiter.
+//
+// Blank lines written by Flush and Drain are written into backend as is. It
+// implies WithEnsureNewline(true).
+func WithEnsureNewlineAlways() Option {
+	return func(writer *Writer) {
+		writer.ensureNewline = true
+		writer.ensureAlways = true
+	}
+}
+
+// WithDelimiter makes Writer to treat `delimiter` as line terminator instead
+// of newline. Non-ASCII delimiter is matched by its UTF-8 encoding, which
+// is handled as multi-byte delimiter, see WithDelimiterBytes.
+func WithDelimiter(delimiter rune) Option {
+	return func(writer *Writer) {
+		writer.newline = delimiter
+		writer.delimiters = nil
+	}
+}
+
+// WithDelimiterBytes makes Writer to treat given byte sequence as line
+// terminator. Bytes at the end of buffered data, that can be the beginning of
+// delimiter, will not be written until it's known, whether delimiter is
+// complete or not. Empty sequence means default delimiter.
+func WithDelimiterBytes(delimiter []byte) Option {
+	return func(writer *Writer) {
+		writer.delimiters = append([]byte(nil), delimiter...)
+	}
+}
+
+// WithSoftFlushDelimiter makes Writer to write incomplete line into backend
+// up to the end of the last occurrence of given byte sequence, e.g. end of
+// sentence, as soon as it appears in written data, so data is delivered with
+// lower latency. Soft delimiter does not terminate line: data is written as
+// is and rest of line is written as its continuation, like on Flush.
+//
+// If written data contains both delimiters, complete lines are written as
+// usual and soft delimiter is searched only in incomplete line after them.
+// Soft delimiter makes batch specified by WithBatchBytes to be written too.
+func WithSoftFlushDelimiter(delimiter []byte) Option {
+	return func(writer *Writer) {
+		writer.soft = append([]byte(nil), delimiter...)
+	}
+}
+
+// WithCRLF makes Writer to treat CRLF as line terminator instead of
+// configured delimiter. Carriage return at the end of buffered data will not
+// be written until it's known, whether it's followed by newline or not.
+func WithCRLF() Option {
+	return WithDelimiterBytes([]byte("\r\n"))
+}
+
+// WithStripDelimiter makes Writer to write every complete line into backend
+// without trailing delimiter, so blank lines are not written at all. Line
+// function receives lines without delimiter too.
+//
+// Incomplete line is written as is on Close, unless `ensureNewline` is
+// specified, in which case it's terminated with delimiter, that is not
+// stripped.
+func WithStripDelimiter() Option {
+	return func(writer *Writer) {
+		writer.strip = true
+	}
+}
+
+// WithCarriageReturnAsLine makes Writer to treat carriage return, that is not
+// followed by delimiter, as line terminator too, so progress bars, which are
+// redrawn by carriage return, are written as soon as they are updated.
+// Carriage return before delimiter is part of line ending, so CRLF terminates
+// single line. Carriage return is written into backend only if `keep` is
+// true. Carriage return at the end of buffered data is not written until it's
+// known what follows it.
+func WithCarriageReturnAsLine(keep bool) Option {
+	return func(writer *Writer) {
+		writer.carriage = true
+		writer.keepCarriage = keep
+	}
+}
+
+// WithNormalizeNewlines makes Writer to terminate every line with single
+// delimiter, replacing CRLF and carriage return, that terminates line, with
+// delimiter, so output of mixed CRLF and LF lines becomes uniform. Carriage
+// return at the end of one write call, that is followed by delimiter at the
+// beginning of the next one, produces single delimiter. It implies
+// WithCarriageReturnAsLine(false).
+func WithNormalizeNewlines() Option {
+	return func(writer *Writer) {
+		writer.carriage = true
+		writer.keepCarriage = false
+		writer.normalize = true
+	}
+}
+
+// WithHeader makes Writer to write given header into backend right before
+// the first data, so header is not written at all if nothing is written into
+// backend. Header is written into backend as is, so it should be terminated
+// with delimiter. Header is written again into new backend after Reset or
+// SwapBackend.
+func WithHeader(header []byte) Option {
+	return func(writer *Writer) {
+		writer.header = append([]byte(nil), header...)
+	}
+}
+
+// WithPreamble makes Writer to write given bytes into backend right before
+// the first data and header, e.g. UTF-8 BOM. Unlike header, preamble is
+// written as is without any line processing and only once during Writer
+// lifetime, so it's not written into new backend after SwapBackend or Reset.
+// Preamble is not written at all if nothing is written into backend.
+func WithPreamble(preamble []byte) Option {
+	return func(writer *Writer) {
+		writer.preamble = append([]byte(nil), preamble...)
+	}
+}
+
+// WithTrailer makes Writer to write given trailer into backend on Close after
+// all remaining data is written, including delimiter added due to
+// `ensureNewline`, and before backend is closed. Trailer is written only if
+// anything was written into backend and only if remaining data was written
+// successfully. Backend returned by SwapBackend doesn't get trailer.
+func WithTrailer(trailer []byte) Option {
+	return func(writer *Writer) {
+		writer.trailer = append([]byte(nil), trailer...)
+	}
+}
+
+// WithEmptyMarker makes Writer to write given marker into backend on Close if
+// nothing was written into backend, e.g. "(no output)\n", so empty output is
+// distinguishable from output of job, that did not run. Marker is written as
+// is, without line processing, after remaining data, so it's suppressed by
+// remaining data too, unless it's discarded by WithDiscardPartialOnClose.
+// Marker is not written if remaining data can't be written. Marker is
+// treated as data: preamble and header are written before it and trailer is
+// written after it. Only current backend is checked, so marker is written into
+// backend set by SwapBackend or Reset if nothing was written into it.
+func WithEmptyMarker(marker []byte) Option {
+	return func(writer *Writer) {
+		writer.marker = append([]byte(nil), marker...)
+	}
+}
+
+// WithPrefix makes Writer to prepend every line written into backend with
+// given prefix.
+func WithPrefix(prefix string) Option {
+	return func(writer *Writer) {
+		writer.prefix = []byte(prefix)
+	}
+}
+
+// WithTimestamp makes Writer to prepend every line written into backend with
+// current time formatted according to `format` and followed by space. Empty
+// format means time.RFC3339. Time is taken right before line is written into
+// backend, not when it's written into Writer. Timestamp precedes prefix.
+func WithTimestamp(format string) Option {
+	if format == "" {
+		format = time.RFC3339
+	}
+
+	return func(writer *Writer) {
+		writer.timestamp = format
+	}
+}
+
+// WithClock makes Writer to take time for timestamps, specified by
+// WithTimestamp, from given `clock` instead of time.Now, e.g. for
+// reproducible output in tests. Nil clock means time.Now.
+func WithClock(clock func() time.Time) Option {
+	if clock == nil {
+		clock = time.Now
+	}
+
+	return func(writer *Writer) {
+		writer.clock = clock
+	}
+}
+
+// WithMaxBufferBytes makes Writer to write buffered incomplete line into
+// backend as soon as it reaches `size` bytes. Zero size means no limit.
+func WithMaxBufferBytes(size int) Option {
+	return func(writer *Writer) {
+		writer.maxBuffer = size
+	}
+}
+
+// WithSizeOrLineFlush makes Writer to write data into backend by chunks of at
+// most `size` bytes of buffered data, each ending at line boundary, e.g. for
+// streaming upload of roughly equal parts. Complete lines are written as soon
+// as they are available, like without this option, but several lines, that
+// take more than `size` bytes, are written by several backend writes, each
+// containing as many complete lines as fit into `size` bytes.
+//
+// Line, that is longer than `size` bytes, is split into parts of `size`
+// bytes, which are written as is, so line is continued by the next part.
+// Incomplete line is written as soon as it reaches `size` bytes, like with
+// WithMaxBufferBytes, so latency is bounded. Size is measured before prefix
+// and other line processing. Zero size means no limit.
+func WithSizeOrLineFlush(size int) Option {
+	return func(writer *Writer) {
+		writer.chunkSize = size
+	}
+}
+
+// WithLineFunc makes Writer to pass every line, including its terminator,
+// through given function right before writing it into backend and write
+// function result instead. Line, which result is empty, is not written at
+// all. Incomplete line is passed through function only when it's forcibly
+// written by Flush, by reaching max buffer size or on Close. Prefix, if
+// specified, is prepended to function result.
+func WithLineFunc(fn func(line []byte) []byte) Option {
+	return func(writer *Writer) {
+		writer.lineFunc = fn
+	}
+}
+
+// WithDiscardPartialOnClose makes Writer to discard incomplete line instead of
+// writing it into backend on Close. It takes precedence over ensureNewline.
+func WithDiscardPartialOnClose(discard bool) Option {
+	return func(writer *Writer) {
+		writer.discardPartial = discard
+	}
+}
+
+// WithMaxTotalBytes makes Writer to write at most `size` bytes into backend
+// during its lifetime, including prefixes and other added data. Data at the
+// limit boundary is truncated, so exactly `size` bytes are written and line
+// can be left incomplete. Once limit is reached, writing methods return
+// ErrOutputLimitExceeded without writing anything. Zero size means no limit.
+func WithMaxTotalBytes(size int64) Option {
+	return func(writer *Writer) {
+		writer.maxTotal = size
+	}
+}
+
+// WithForceLinePerWrite makes Writer to start data of every write call from
+// new line: if previous write ended with incomplete line, delimiter is
+// inserted before new data. Nothing is inserted if previous write ended with
+// delimiter or if new data is empty. Consecutive WriteByte calls are treated
+// as single write call.
+func WithForceLinePerWrite() Option {
+	return func(writer *Writer) {
+		writer.forceLine = true
+	}
+}
+
+// WithBatchBytes makes Writer to keep complete lines in the buffer until they
+// take at least `size` bytes and then write them into backend at once, which
+// is useful for compressing backends and for frequent tiny writes, like
+// fmt.Fprintf in a loop, since lock is acquired once per batch instead of
+// once per line. Only complete lines are written, unless incomplete line is
+// forcibly written due to max line or buffer size.
+//
+// Flush writes batch along with incomplete line, while Drain writes batch
+// only. Close writes batch and incomplete line at once, incomplete line is
+// terminated with delimiter if `ensureNewline` is specified. Zero size means
+// that lines are written as soon as they are complete.
+func WithBatchBytes(size int) Option {
+	return func(writer *Writer) {
+		writer.batch = size
+	}
+}
+
+// WithMaxLineBytes makes Writer to cut lines, which are longer than `size`
+// bytes, into several lines, each terminated with delimiter. Incomplete line
+// is cut as soon as it exceeds `size` bytes, so line of exactly `size` bytes
+// is terminated only when it's continued. Zero size means no limit.
+//
+// Unlike WithMaxBufferBytes, which writes incomplete line as is, so it's
+// continued by following writes, this option produces separate lines. If both
+// are specified, incomplete line written due to max buffer size is still cut
+// at max line size and rest of the line is counted towards max line size.
+func WithMaxLineBytes(size int) Option {
+	return func(writer *Writer) {
+		writer.maxLine = size
+	}
+}
+
+// WithLineNumbers makes Writer to prepend every line written into backend with
+// its number, starting from `start`. Numbers are right-aligned to the width of
+// 4 digits, which grows to the width of the widest number written so far, so
+// lines following it are aligned with it. Line number follows prefix, if it's
+// specified.
+func WithLineNumbers(start int) Option {
+	return func(writer *Writer) {
+		writer.numbering = true
+		writer.number = start
+	}
+}
+
+// WithCollapseBlankLines makes Writer to write only first one of consecutive
+// blank lines, that consist of delimiter only, including blank lines of
+// different write calls. Line is checked after ANSI escape sequences are
+// stripped and line function is applied, so line function can produce blank
+// lines too. Prefix and line number are not added to dropped lines.
+func WithCollapseBlankLines() Option {
+	return func(writer *Writer) {
+		writer.collapse = true
+	}
+}
+
+// WithBuffer makes Writer to use memory of given slice for buffering data
+// instead of allocating own, so slices can be pre-sized or taken from a pool.
+// Writer owns the memory until it's closed, Reset keeps using the same memory.
+// If buffered data exceeds capacity of given slice, Writer allocates larger
+// one and given slice is not used anymore.
+func WithBuffer(buffer []byte) Option {
+	return func(writer *Writer) {
+		writer.buffer = buffer[:0]
+	}
+}
+
+// WithInitialCapacity makes Writer to allocate buffer of `size` bytes in
+// advance, so writers, that handle large lines, don't reallocate buffer while
+// it grows during the first writes. It replaces memory specified by
+// WithBuffer, if it's specified before.
+func WithInitialCapacity(size int) Option {
+	return func(writer *Writer) {
+		writer.buffer = make([]byte, 0, size)
+	}
+}
+
+// WithScratchSize makes Writer to allocate `size` bytes in advance for
+// memory, that is used for assembling lines with prefix and other per-line
+// options applied before they are written into backend. Memory is reused by
+// subsequent writes and grows only if lines exceed its size, so writing
+// lines, that are smaller than `size`, doesn't allocate memory.
+func WithScratchSize(size int) Option {
+	return func(writer *Writer) {
+		writer.scratch = make([]byte, 0, size)
+	}
+}
+
+// WithShrinkThreshold makes Writer to release memory of the buffer after data
+// is written into backend, if buffer capacity exceeds `size` bytes, while
+// remaining data is smaller, so memory, that was allocated for huge line, is
+// not held for the whole lifetime of Writer. Memory specified by WithBuffer
+// is released too. Zero size means that buffer is never shrunk.
+func WithShrinkThreshold(size int) Option {
+	return func(writer *Writer) {
+		writer.shrink = size
+	}
+}
+
+// WithTrimTrailingSpace makes Writer to remove spaces and tabs at the end of
+// every complete line, right before delimiter, keeping delimiter itself.
+// Incomplete line is trimmed only when it's written on Close, because
+// otherwise it can be continued by subsequent writes. Lines are trimmed
+// before ANSI escape sequences are stripped and line function is applied.
+func WithTrimTrailingSpace() Option {
+	return func(writer *Writer) {
+		writer.trimSpace = true
+	}
+}
+
+// WithStripANSI makes Writer to remove ANSI CSI escape sequences, like color
+// codes, from every line before writing it into backend. Escape sequences are
+// stripped before line function is applied. Incomplete escape sequence at the
+// end of buffered data is not written until it's complete.
+func WithStripANSI(strip bool) Option {
+	return func(writer *Writer) {
+		writer.stripANSI = strip
+	}
+}
+
+// WithSanitizeControlChars makes Writer to replace control characters in
+// every line, except tab and line delimiter, with their escaped
+// representation, like `\x1b`, so output can be safely rendered, e.g. by log
+// viewer. Multi-byte UTF-8 sequences are kept as is, while C1 control
+// characters are replaced with `\u0085`-like representation.
+//
+// Lines are sanitized after ANSI escape sequences are stripped and line
+// function is applied. Incomplete line is sanitized too, when it's forcibly
+// written into backend.
+func WithSanitizeControlChars() Option {
+	return func(writer *Writer) {
+		writer.sanitize = true
+	}
+}
+
+// WithValidUTF8 makes Writer to replace invalid UTF-8 sequences in every line
+// with given replacement rune before writing it into backend, so backend,
+// that accepts only valid UTF-8, doesn't fail. Every run of invalid bytes is
+// replaced with single rune. Zero or invalid replacement means
+// utf8.RuneError.
+//
+// Multi-byte sequence, that is split between write calls, is not replaced,
+// since beginning of the sequence at the end of buffered data is not written
+// until it's complete, unless it's written on Close. Lines are validated
+// after all other line processing.
+func WithValidUTF8(replacement rune) Option {
+	return func(writer *Writer) {
+		if replacement == 0 || !utf8.ValidRune(replacement) {
+			replacement = utf8.RuneError
+		}
+
+		writer.replacement = utf8.AppendRune(nil, replacement)
+	}
+}
+
+// WithJSONLineMode makes Writer to treat delimiter as line terminator only if
+// it's not inside of JSON string, object or array, so JSON record, which
+// contains unescaped newline in string, is written as single line.
+//
+// It's a heuristic, that only tracks brackets and quotes, JSON itself is not
+// validated. Stray opening bracket or quote in malformed input makes Writer to
+// keep buffering data until brackets are closed, so it's recommended to
+// specify WithMaxBufferBytes too. Text, that is not JSON, is written as usual
+// unless it contains brackets or quotes.
+func WithJSONLineMode() Option {
+	return func(writer *Writer) {
+		writer.jsonLines = true
+	}
+}
+
+// WithTee makes Writer to write everything, that is written into backend, into
+// given tee writer too. Errors of tee writer are returned from writing methods
+// only if `propagateErrors` is true, otherwise they are ignored.
+func WithTee(tee io.Writer, propagateErrors bool) Option {
+	return func(writer *Writer) {
+		writer.tee = tee
+		writer.teeErrors = propagateErrors
+	}
+}
+
+// WithLineRouter makes Writer to call given router for every complete line,
+// right before it's written into backend, and to write that line into
+// returned writer too after it's written into backend, e.g. to copy error
+// lines into stderr. Nil writer means that line is written into backend only.
+// Router receives line after ANSI escape sequences are stripped and line
+// function is applied, but without prefix, while line is written into
+// returned writer exactly as it's written into backend. If beginning of the
+// line was written earlier, e.g. by Flush, only rest of the line is passed.
+//
+// Router and returned writers are called while Writer mutex and lock are
+// held, so they must not call methods of Writer or of writers sharing the same
+// lock. Errors of returned writers are ignored.
+func WithLineRouter(router func(line []byte) io.Writer) Option {
+	return func(writer *Writer) {
+		writer.router = router
+	}
+}
+
+// WithoutBackendClose makes Writer to not close backend on Close and Abort,
+// so backend lifecycle is owned by caller, e.g. when backend is entry of
+// archive, which closing finalizes the whole archive. Close still writes all
+// remaining data, terminating incomplete line if `ensureNewline` is
+// specified, and trailer. Writer returned by NewAsync still waits on Close
+// until queued data is written into backend and goroutine exits.
+func WithoutBackendClose() Option {
+	return func(writer *Writer) {
+		writer.keepBackend = true
+	}
+}
+
+// WithCloseHook makes Writer to call given function at the end of Close, after
+// backend is closed, with amount of bytes flushed from the buffer on close and
+// error returned by Close. Function is called without holding any locks.
+func WithCloseHook(hook func(flushed int, err error)) Option {
+	return func(writer *Writer) {
+		writer.closeHook = hook
+	}
+}
+
+// WithPartialAtCloseHook makes Writer to call given function on Close with
+// copy of incomplete line, that is buffered, right before it's written into
+// backend, terminated due to `ensureNewline` or discarded, so truncated
+// output can be detected. Function is not called if buffer is empty or ends
+// with delimiter.
+//
+// Function is called while Writer mutex is held, so it must not call methods
+// of Writer.
+func WithPartialAtCloseHook(hook func(partial []byte)) Option {
+	return func(writer *Writer) {
+		writer.partialHook = hook
+	}
+}
+
+// WithFlushObserver makes Writer to call given function right after every
+// complete line is written into backend with length of the line as it was
+// written, including prefix and delimiter. If beginning of the line was
+// written earlier, e.g. by Flush, only length of the rest is passed.
+//
+// Function is called synchronously while Writer mutex and lock are held, so it
+// must not call methods of Writer or of writers sharing the same lock.
+func WithFlushObserver(observer func(size int)) Option {
+	return func(writer *Writer) {
+		writer.observer = observer
+	}
+}
+
+// WithWriteTimingHook makes Writer to call given function after every write
+// into backend with duration of the write and amount of bytes written, e.g.
+// for collecting latency histogram of slow backend. Duration covers only
+// backend write itself, so waiting for the lock and processing of lines are
+// not included. Every backend write is reported, including writes of header
+// and of incomplete lines.
+//
+// Function is called synchronously while Writer mutex and lock are held, so it
+// must not call methods of Writer or of writers sharing the same lock.
+func WithWriteTimingHook(
+	hook func(duration time.Duration, written int),
+) Option {
+	return func(writer *Writer) {
+		writer.timingHook = hook
+	}
+}
+
+// WithRetainOnError makes Writer to keep data, that was not written into
+// backend due to error, in the buffer, so it's written again by subsequent
+// Write, Flush or Close before any new data. In that case writing methods
+// report all given data as written along with backend error.
+func WithRetainOnError() Option {
+	return func(writer *Writer) {
+		writer.retain = true
+	}
+}
+
+// WithStickyError makes Writer to remember the first error of writing into
+// backend and return it from all subsequent writing methods, Flush and Close
+// without buffering any more data, so data is not accepted if it can't be
+// delivered anymore. Close still closes backend. Error is cleared by Reset and
+// SwapBackend, latter writes buffered lines into new backend.
+func WithStickyError() Option {
+	return func(writer *Writer) {
+		writer.sticky = true
+	}
+}
+
+// WithUnsynchronized makes Writer to skip all locking, including lock
+// specified by WithLock.
+//
+// Writer becomes NOT thread-safe: it must be used by single goroutine only
+// and must not share backend with other writers, that are used concurrently.
+func WithUnsynchronized() Option {
+	return func(writer *Writer) {
+		writer.mutex = nopLocker{}
+		writer.lock = nopLocker{}
+	}
+}
+
+// nopLocker implements sync.Locker, that does nothing.
+type nopLocker struct{}
+
+func (nopLocker) Lock()   {}
+func (nopLocker) Unlock() {}
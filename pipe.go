@@ -0,0 +1,22 @@
+package lineflushwriter
+
+import (
+	"io"
+	"sync"
+)
+
+// NewPipe returns new Writer, that works exactly like one returned by New,
+// and reader, that yields only complete lines written into Writer. Reader
+// returns EOF after Writer is closed and remaining data is read.
+//
+// Writer is backed by io.Pipe, so writing methods block until lines are read
+// from reader.
+func NewPipe(
+	lock sync.Locker,
+	ensureNewline bool,
+	options ...Option,
+) (*Writer, io.Reader) {
+	reader, writer := io.Pipe()
+
+	return New(writer, lock, ensureNewline, options...), reader
+}
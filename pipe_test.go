@@ -0,0 +1,45 @@
+package lineflushwriter
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPipe_ReadsCompleteLinesUntilClose(t *testing.T) {
+	test := assert.New(t)
+
+	writer, reader := NewPipe(&sync.Mutex{}, true)
+
+	done := make(chan []byte)
+
+	go func() {
+		data, _ := io.ReadAll(reader)
+		done <- data
+	}()
+
+	writer.Write([]byte("1\n2"))
+	writer.Write([]byte("3\n4"))
+	writer.Close()
+
+	test.Equal("1\n23\n4\n", string(<-done))
+}
+
+func TestNewPipe_YieldsOnlyCompleteLines(t *testing.T) {
+	test := assert.New(t)
+
+	writer, reader := NewPipe(&sync.Mutex{}, false)
+
+	go func() {
+		writer.Write([]byte("1"))
+		writer.Write([]byte("2\n3"))
+	}()
+
+	data := make([]byte, 10)
+
+	read, err := reader.Read(data)
+	test.NoError(err)
+	test.Equal("12\n", string(data[:read]))
+}
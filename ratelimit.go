@@ -0,0 +1,90 @@
+package lineflushwriter
+
+import (
+	"errors"
+	"time"
+)
+
+// RateLimitMode specifies, what Writer does with lines, that exceed rate
+// limit specified by WithRateLimit.
+type RateLimitMode int
+
+const (
+	// RateLimitBlock makes Writer to wait until line can be written without
+	// exceeding rate limit.
+	RateLimitBlock RateLimitMode = iota
+
+	// RateLimitDrop makes Writer to drop lines, that exceed rate limit.
+	RateLimitDrop
+)
+
+// errRateLimited is returned by writeLines if remaining lines can be written
+// only after waiting for rate limit. It's never returned to caller.
+var errRateLimited = errors.New("lineflushwriter: rate limit exceeded")
+
+// WithRateLimit makes Writer to write at most `linesPerSecond` lines into
+// backend per second. Lines, that exceed limit, are either dropped or written
+// after waiting, depending on given mode. Time is taken from clock specified
+// by WithClock. Lines, that were accepted before waiting, are written into
+// backend first and Writer waits without holding the lock, so writers sharing
+// the same lock are not stalled. Dropped lines are reported by Dropped.
+// Incomplete line, that was written into backend, is counted as line, so its
+// rest is dropped or written together with it.
+func WithRateLimit(linesPerSecond int, mode RateLimitMode) Option {
+	return func(writer *Writer) {
+		writer.limiter = &rateLimiter{
+			rate: linesPerSecond,
+			mode: mode,
+		}
+	}
+}
+
+// Dropped returns amount of lines, that were dropped due to rate limit, limit
+// specified by WithDropOldest or DropPolicy of writer returned by NewAsync.
+func (writer *Writer) Dropped() uint64 {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.dropped
+}
+
+// rateLimiter counts lines written during every second.
+type rateLimiter struct {
+	rate  int
+	mode  RateLimitMode
+	start time.Time
+	count int
+}
+
+// take counts line and returns true if it can be written at given time. Line
+// is always counted in RateLimitBlock mode, since Writer waits for limit
+// before taking line, see exhausted.
+func (limiter *rateLimiter) take(now time.Time) bool {
+	if now.Sub(limiter.start) >= time.Second {
+		limiter.start = now
+		limiter.count = 0
+	}
+
+	if limiter.count >= limiter.rate && limiter.mode == RateLimitDrop {
+		return false
+	}
+
+	limiter.count++
+
+	return true
+}
+
+// exhausted returns true if one more line can't be written at given time
+// without waiting for the next second.
+func (limiter *rateLimiter) exhausted(now time.Time) bool {
+	return now.Sub(limiter.start) < time.Second &&
+		limiter.count >= max(limiter.rate, 1)
+}
+
+// wait waits for the next second, which starts after waiting.
+func (limiter *rateLimiter) wait(clock func() time.Time) {
+	time.Sleep(limiter.start.Add(time.Second).Sub(clock()))
+
+	limiter.start = clock()
+	limiter.count = 0
+}
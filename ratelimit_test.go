@@ -0,0 +1,84 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_DropsLinesExceedingRateLimit(t *testing.T) {
+	test := assert.New(t)
+
+	now := time.Now()
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithRateLimit(2, RateLimitDrop),
+		WithClock(func() time.Time {
+			return now
+		}),
+	)
+
+	writer.Write([]byte("1\n2\n3\n4"))
+	writer.Flush()
+	writer.Write([]byte("5\n"))
+	test.Equal("1\n2\n", buffer.String())
+	test.EqualValues(2, writer.Dropped())
+
+	now = now.Add(time.Second)
+
+	writer.Write([]byte("6\n"))
+	test.Equal("1\n2\n6\n", buffer.String())
+	test.EqualValues(2, writer.Dropped())
+}
+
+func TestWriter_WaitsForLinesExceedingRateLimit(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		lock    = &sync.Mutex{}
+		buffer  = &bytes.Buffer{}
+		started = time.Now()
+		done    = make(chan struct{})
+	)
+
+	writer := New(
+		nopCloser{buffer}, lock, false,
+		WithRateLimit(2, RateLimitBlock),
+	)
+
+	go func() {
+		defer close(done)
+
+		writer.Write([]byte("1\n2\n3\n"))
+	}()
+
+	received := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return buffer.String()
+	}
+
+	// Accepted lines are written before waiting and shared lock is free
+	// while writer waits.
+	test.Eventually(func() bool {
+		return received() == "1\n2\n"
+	}, time.Second, time.Millisecond)
+
+	select {
+	case <-done:
+		test.Fail("write should wait for rate limit")
+	default:
+	}
+
+	<-done
+
+	test.Equal("1\n2\n3\n", buffer.String())
+	test.True(time.Since(started) >= time.Second)
+	test.EqualValues(0, writer.Dropped())
+}
@@ -0,0 +1,78 @@
+package lineflushwriter
+
+import (
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// sanitizeControls returns given data with control characters, except tab,
+// replaced by their escaped representation: `\xNN` for ASCII control
+// characters and `\u00NN` for C1 control characters. Invalid UTF-8 sequences
+// are kept as is. Data is returned as is if it has no control characters.
+func sanitizeControls(data []byte) []byte {
+	var result []byte
+
+	for i := 0; i < len(data); {
+		char, size := rune(data[i]), 1
+		if char >= utf8.RuneSelf {
+			char, size = utf8.DecodeRune(data[i:])
+		}
+
+		if !isControl(char) {
+			if result != nil {
+				result = append(result, data[i:i+size]...)
+			}
+
+			i += size
+
+			continue
+		}
+
+		if result == nil {
+			result = append([]byte(nil), data[:i]...)
+		}
+
+		if char < utf8.RuneSelf {
+			result = append(result, '\\', 'x')
+		} else {
+			result = append(result, '\\', 'u', '0', '0')
+		}
+
+		result = append(result, hexDigits[char>>4], hexDigits[char&0xf])
+
+		i += size
+	}
+
+	if result == nil {
+		return data
+	}
+
+	return result
+}
+
+// isControl returns true if given character is control character, that
+// should be escaped.
+func isControl(char rune) bool {
+	return char < 0x20 && char != '\t' ||
+		char >= 0x7f && char <= 0x9f
+}
+
+// incompleteRune returns length of the beginning of multi-byte UTF-8 sequence
+// at the end of given data, or zero if data ends with complete rune.
+func incompleteRune(data []byte) int {
+	for size := 1; size < utf8.UTFMax && size <= len(data); size++ {
+		start := len(data) - size
+		if !utf8.RuneStart(data[start]) {
+			continue
+		}
+
+		if utf8.FullRune(data[start:]) {
+			return 0
+		}
+
+		return size
+	}
+
+	return 0
+}
@@ -0,0 +1,79 @@
+package lineflushwriter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_SanitizesControlCharactersInLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, true,
+		WithSanitizeControlChars(),
+	)
+
+	writer.Write([]byte("\x1b[31mred\x1b[0m\tок\n\x00\u0085\x7f"))
+	test.Equal("\\x1b[31mred\\x1b[0m\tок\n", buffer.String())
+
+	writer.Close()
+	test.Equal(
+		"\\x1b[31mred\\x1b[0m\tок\n\\x00\\u0085\\x7f\n",
+		buffer.String(),
+	)
+}
+
+func TestWriter_KeepsMultiByteDelimiterOnSanitize(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithCRLF(), WithSanitizeControlChars(), WithPrefix("> "),
+	)
+
+	writer.Write([]byte("1\r2\r\n\xff3\r\n"))
+	test.Equal("> 1\\x0d2\r\n> \xff3\r\n", buffer.String())
+}
+
+func TestWriter_ReplacesInvalidUTF8InLines(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithValidUTF8('?'),
+	)
+
+	writer.Write([]byte("a\xff\xfeb\xc3\n\x80ок\n"))
+	test.Equal("a?b?\n?ок\n", buffer.String())
+
+	writer.Write([]byte("\xd0"))
+	writer.Close()
+	test.Equal("a?b?\n?ок\n?", buffer.String())
+}
+
+func TestWriter_KeepsRuneSplitBetweenWritesOnValidUTF8(t *testing.T) {
+	test := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	writer := New(
+		nopCloser{buffer}, &sync.Mutex{}, false,
+		WithValidUTF8(0),
+	)
+
+	writer.Write([]byte("о\xd0"))
+	test.NoError(writer.Flush())
+	test.Equal("о", buffer.String())
+
+	writer.Write([]byte("\xba\xe2\x82"))
+	test.NoError(writer.Flush())
+	test.Equal("ок", buffer.String())
+
+	writer.Write([]byte("\xac\n\xff\n"))
+	test.Equal("ок€\n�\n", buffer.String())
+}
@@ -0,0 +1,56 @@
+package lineflushwriter
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_WritesEverySlogRecordBySingleBackendWrite(t *testing.T) {
+	test := assert.New(t)
+
+	var (
+		backend = &chunkRecorder{}
+		writer  = NewFromWriter(backend, &sync.Mutex{}, false)
+		logger  = slog.New(slog.NewTextHandler(writer, nil))
+		wg      = sync.WaitGroup{}
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				logger.Info("message", "goroutine", id, "index", j)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	test.Len(backend.chunks, 1000)
+
+	for _, chunk := range backend.chunks {
+		test.Equal(1, strings.Count(chunk, "\n"), chunk)
+		test.True(strings.HasSuffix(chunk, "\n"), chunk)
+		test.Contains(chunk, "msg=message goroutine=")
+	}
+
+	for i := 0; i < 10; i++ {
+		records := 0
+
+		for _, chunk := range backend.chunks {
+			if strings.Contains(chunk, fmt.Sprintf("goroutine=%d ", i)) {
+				records++
+			}
+		}
+
+		test.Equal(100, records)
+	}
+}